@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/api"
+	"github.com/njwong/me-api/middleware"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newApp serves the public routes for s like main does, followed by the
+// admin routes behind authentication, which tests can't get past
+func newApp(s *store.Store) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+
+	api.AddCharactersRoutes(app, s)
+	api.AddGendersEndpoints(app, s)
+	api.AddSpeciesEndpoints(app, s)
+
+	app.Use(middleware.JWTAuth)
+	api.AddAdminCharacterRoutes(app, s)
+	api.AddAdminGendersEndpoints(app, s)
+	api.AddAdminSpeciesEndpoints(app, s)
+
+	return app
+}
+
+// request sends a request to app with an optional JSON body, and returns the
+// response with its body
+func request(t *testing.T, app *fiber.App, method, url, body string) (*http.Response, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	resp, err := app.Test(req)
+	mustDo(t, err)
+
+	data, err := io.ReadAll(resp.Body)
+	mustDo(t, err)
+
+	return resp, string(data)
+}
+
+// page is the envelope of a list response, with each result as an object
+type page struct {
+	Count    int              `json:"count"`
+	Next     *string          `json:"next"`
+	Previous *string          `json:"previous"`
+	Results  []map[string]any `json:"results"`
+}
+
+// list gets a page of a list endpoint, failing unless it is served
+func list(t *testing.T, app *fiber.App, url string) page {
+	t.Helper()
+
+	resp, body := request(t, app, fiber.MethodGet, url, "")
+
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("GET %s gave %d: %s", url, resp.StatusCode, body)
+	}
+
+	var response page
+	mustDo(t, json.Unmarshal([]byte(body), &response))
+
+	return response
+}
+
+// ids returns the IDs of the results of a page
+func (p page) ids() []int {
+	ids := []int{}
+
+	for _, result := range p.Results {
+		id, _ := result["id"].(float64)
+		ids = append(ids, int(id))
+	}
+
+	return ids
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+// Fields the audit log can be sorted by, e.g. -id for the newest first
+var auditSortFields = []string{"id"}
+
+// Resources that are recorded in the audit log
+var auditResources = []string{store.ResourceCharacters, store.ResourceGenders, store.ResourceSpecies}
+
+func AddAdminAuditRoutes(app *fiber.App, s *store.Store) {
+	apiGroup := app.Group("/api")
+	apiGroup.Get("/admin/audit", handleGetAudit(s.Audit))
+}
+
+// handleGetAudit lists the audit log, filtered by resource, resource_id,
+// actor and a since/until time range
+func handleGetAudit(audit store.AuditStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		opts, err := parseListOptions(c, auditSortFields)
+
+		if err != nil {
+			return err
+		}
+
+		filter, err := parseAuditFilter(c)
+
+		if err != nil {
+			return err
+		}
+
+		entries, total, err := audit.List(c.UserContext(), filter, pageOptions(opts))
+
+		if err != nil {
+			return storeError(err, "")
+		}
+
+		for i := range entries {
+			entries[i].URL = resourceURL(c, entries[i].Resource, entries[i].ResourceID)
+		}
+
+		response := newPage(c, opts, entries, total, func(entry models.AuditEntry) int { return entry.ID })
+
+		return sendPage(c, response, nil)
+	}
+}
+
+// parseAuditFilter reads the audit log filters from the query string. Times
+// are RFC 3339 timestamps, e.g. 2023-06-17T00:00:00Z.
+func parseAuditFilter(c *fiber.Ctx) (store.AuditFilter, error) {
+	filter := store.AuditFilter{
+		Resource: c.Query("resource"),
+		Actor:    c.Query("actor"),
+	}
+
+	if filter.Resource != "" && !contains(auditResources, filter.Resource) {
+		return filter, problem.BadRequest("Invalid resource")
+	}
+
+	if raw := c.Query("resource_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+
+		if err != nil || id < 1 {
+			return filter, problem.BadRequest("Invalid resource_id")
+		}
+
+		filter.ResourceID = id
+	}
+
+	params := []struct {
+		name  string
+		value *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	}
+
+	for _, param := range params {
+		raw := c.Query(param.name)
+
+		if raw == "" {
+			continue
+		}
+
+		value, err := time.Parse(time.RFC3339, raw)
+
+		if err != nil {
+			return filter, problem.BadRequest("Invalid " + param.name)
+		}
+
+		*param.value = value
+	}
+
+	return filter, nil
+}
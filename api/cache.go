@@ -0,0 +1,18 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/store"
+)
+
+func AddAdminCacheRoutes(app *fiber.App, cache *store.Cache) {
+	apiGroup := app.Group("/api")
+	apiGroup.Get("/admin/cache", handleGetCacheStats(cache))
+}
+
+// handleGetCacheStats reports the read cache's hit and miss counters
+func handleGetCacheStats(cache *store.Cache) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(cache.Stats())
+	}
+}
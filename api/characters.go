@@ -1,247 +1,464 @@
 package api
 
 import (
-	"database/sql"
-	"fmt"
+	"errors"
+	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/njwong/me-api/database"
 	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
 )
 
-func AddCharactersRoutes(app *fiber.App) {
+func AddCharactersRoutes(app *fiber.App, s *store.Store) {
 	apiGroup := app.Group("/api")
-	apiGroup.Get("/characters", handleGetCharacters)
-	apiGroup.Get("/characters/:id", handleGetCharacter)
+	apiGroup.Get("/characters", handleGetCharacters(s.Characters, s.Audit, false))
+	apiGroup.Get("/characters/:id", handleGetCharacter(s.Characters, s.Audit))
+	apiGroup.Get("/characters/:id/revisions", handleGetRevisions(s, store.ResourceCharacters, "Character not found", false))
+	apiGroup.Get("/characters/:id/revisions/:rev", handleGetRevision(s, store.ResourceCharacters, false))
 }
 
-func AddAdminCharacterRoutes(app *fiber.App) {
+func AddAdminCharacterRoutes(app *fiber.App, s *store.Store) {
 	apiGroup := app.Group("/api")
-	apiGroup.Post("/characters", handleCreateCharacter)
-	apiGroup.Put("/characters/:id", handleUpdateCharacter)
-	apiGroup.Delete("/characters/:id", handleDeleteCharacterById)
+	apiGroup.Get("/characters", handleGetCharacters(s.Characters, s.Audit, true))
+	apiGroup.Get("/characters/:id/revisions", handleGetRevisions(s, store.ResourceCharacters, "Character not found", true))
+	apiGroup.Get("/characters/:id/revisions/:rev", handleGetRevision(s, store.ResourceCharacters, true))
+	apiGroup.Post("/characters", handleCreateCharacter(s))
+	apiGroup.Put("/characters/:id", handleUpdateCharacter(s))
+	apiGroup.Patch("/characters/:id", handlePatchCharacter(s))
+	apiGroup.Delete("/characters/:id", handleDeleteCharacterById(s))
+	apiGroup.Post("/characters/:id/restore", handleRestoreCharacter(s))
+	apiGroup.Post("/characters/:id/revert/:rev", handleRevertCharacter(s))
 }
 
-func handleGetCharacters(c *fiber.Ctx) error {
-	db := database.Client
+// handleGetCharacters lists characters. Deleted ones are only included on the
+// admin route, when admin is set.
+func handleGetCharacters(characters store.CharacterStore, audit store.AuditStore, admin bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		opts, err := parseListOptions(c, characterSortFields)
 
-	query := "SELECT characters.id, characters.name, characters.class, species.id, species.name, genders.id, genders.name FROM characters LEFT JOIN species ON characters.species = species.id LEFT JOIN genders ON characters.gender = genders.id"
+		if err != nil {
+			return err
+		}
 
-	res, err := db.Query(query)
+		// Hand requests for deleted records on to the admin route, which
+		// requires a token
+		if opts.IncludeDeleted && !admin {
+			return c.Next()
+		}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		fields, err := parseFields(c, characterFields)
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Internal server error",
-		})
-	}
-
-	defer res.Close()
+		if err != nil {
+			return err
+		}
 
-	characters := []models.CharacterObject{}
+		expand, err := parseExpand(c, characterRelations)
 
-	for res.Next() {
-		var character models.CharacterObject
-		var speciesID sql.NullInt64
-		var speciesName sql.NullString
-		var genderID sql.NullInt64
-		var genderName sql.NullString
+		if err != nil {
+			return err
+		}
 
-		err := res.Scan(&character.ID, &character.Name, &character.Class, &speciesID, &speciesName, &genderID, &genderName)
+		filter, err := parseCharacterFilter(c)
 
 		if err != nil {
-			fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			return err
+		}
+
+		characterList, total, err := characters.List(c.UserContext(), filter, pageOptions(opts))
 
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"msg": "Internal server error",
-			})
+		if err != nil {
+			return storeError(err, "Character not found")
 		}
 
-		if speciesID.Valid {
-			character.Species = &models.SpeciesObject{
-				ID:   int(speciesID.Int64),
-				Name: speciesName.String,
-				URL:  fmt.Sprintf("https://me-api.fly.dev/api/species/%d", speciesID.Int64),
-			}
+		for i := range characterList {
+			linkCharacter(c, &characterList[i], expand)
 		}
 
-		if genderID.Valid {
-			character.Gender = &models.GenderObject{
-				ID:   int(genderID.Int64),
-				Name: genderName.String,
-				URL:  fmt.Sprintf("https://me-api.fly.dev/api/genders/%d", genderID.Int64),
-			}
+		// Characters include the names of their species and gender
+		err = setLastModified(c, audit,
+			changed{resource: store.ResourceCharacters},
+			changed{resource: store.ResourceSpecies},
+			changed{resource: store.ResourceGenders},
+		)
+
+		if err != nil {
+			return err
 		}
 
-		characters = append(characters, character)
-	}
+		response := newPage(c, opts, characterList, total, func(character models.CharacterObject) int { return character.ID })
 
-	return c.JSON(characters)
+		return sendPage(c, response, fields)
+	}
 }
 
-func handleGetCharacter(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+// parseCharacterFilter reads the species, gender and class query parameters.
+// Species and gender can be given either as an ID or as a name.
+func parseCharacterFilter(c *fiber.Ctx) (store.CharacterFilter, error) {
+	filter := store.CharacterFilter{Class: c.Query("class")}
+
+	var err error
+
+	filter.SpeciesID, filter.SpeciesName, err = parseIDOrName(c.Query("species"))
 
 	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		return filter, problem.BadRequest("Invalid species")
+	}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
-		})
+	filter.GenderID, filter.GenderName, err = parseIDOrName(c.Query("gender"))
+
+	if err != nil {
+		return filter, problem.BadRequest("Invalid gender")
 	}
 
-	character, err := findCharacterByID(id)
+	return filter, nil
+}
 
-	if character == nil || err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+// parseIDOrName splits a query value into either a positive ID or a name
+func parseIDOrName(value string) (int, string, error) {
+	id, err := strconv.Atoi(value)
 
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Character not found",
-		})
+	if err != nil {
+		return 0, value, nil
 	}
 
-	return c.JSON(character)
+	if id < 1 {
+		return 0, "", errors.New("invalid id")
+	}
+
+	return id, "", nil
 }
 
-func findCharacterByID(id int) (*models.Character, error) {
-	db := database.Client
+func handleGetCharacter(characters store.CharacterStore, audit store.AuditStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	var character models.Character
+		if err != nil {
+			return err
+		}
 
-	// TODO - LEFT JOIN to populate the gender and species fields with data
-	query := fmt.Sprintf("SELECT * FROM characters WHERE id = %d", id)
-	err := db.QueryRow(query).Scan(&character.ID, &character.Name, &character.Species, &character.Gender, &character.Class)
+		expand, err := parseExpand(c, characterRelations)
 
-	return &character, err
-}
+		if err != nil {
+			return err
+		}
 
-func handleCreateCharacter(c *fiber.Ctx) error {
-	var character models.Character
+		character, err := getCharacter(c, characters, id)
 
-	err := c.BodyParser(&character)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
-	}
+		// The character includes the names of its species and gender
+		records := []changed{{resource: store.ResourceCharacters, id: character.ID}}
 
-	db := database.Client
+		if character.Species != nil {
+			records = append(records, changed{resource: store.ResourceSpecies, id: character.Species.ID})
+		}
 
-	query := fmt.Sprintf("INSERT INTO characters (name, species, gender, class) VALUES (\"%s\", %d, %d, \"%s\")", character.Name, character.Species, character.Gender, character.Class)
+		if character.Gender != nil {
+			records = append(records, changed{resource: store.ResourceGenders, id: character.Gender.ID})
+		}
 
-	result, err := db.Exec(query)
+		if err := setLastModified(c, audit, records...); err != nil {
+			return err
+		}
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to create character",
-		})
+		return sendCharacter(c, character, expand)
 	}
+}
 
-	id, err := result.LastInsertId()
+func handleCreateCharacter(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		expand, err := parseExpand(c, characterRelations)
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to get character ID",
+		if err != nil {
+			return err
+		}
+
+		var character models.Character
+		var stored *models.CharacterObject
+
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := parseCharacter(c, tx, &character); err != nil {
+				return err
+			}
+
+			if err := tx.Characters.Create(c.UserContext(), &character); err != nil {
+				return storeError(err, "Character not found")
+			}
+
+			stored, err = getCharacter(c, tx.Characters, character.ID)
+			return err
 		})
-	}
 
-	character.ID = int(id)
-	return c.Status(fiber.StatusCreated).JSON(character)
+		if err != nil {
+			return err
+		}
+
+		c.Location(resourceURL(c, store.ResourceCharacters, character.ID))
+		c.Status(fiber.StatusCreated)
+
+		return sendCharacter(c, stored, expand)
+	}
 }
 
-func handleDeleteCharacterById(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+func handleDeleteCharacterById(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := checkCharacterVersion(c, tx.Characters, id); err != nil {
+				return err
+			}
+
+			if err := tx.Characters.Delete(c.UserContext(), id); err != nil {
+				return storeError(err, "Character not found")
+			}
+
+			return nil
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Character deleted"})
 	}
+}
 
-	db := database.Client
+func handleUpdateCharacter(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	query := fmt.Sprintf("DELETE FROM characters WHERE id = %d", id)
+		if err != nil {
+			return err
+		}
 
-	result, err := db.Exec(query)
+		expand, err := parseExpand(c, characterRelations)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
+
+		var stored *models.CharacterObject
+
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := checkCharacterVersion(c, tx.Characters, id); err != nil {
+				return err
+			}
+
+			var character models.Character
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to delete character",
+			if err := parseCharacter(c, tx, &character); err != nil {
+				return err
+			}
+
+			if err := tx.Characters.Update(c.UserContext(), id, &character); err != nil {
+				return storeError(err, "Character not found")
+			}
+
+			stored, err = getCharacter(c, tx.Characters, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendCharacter(c, stored, expand)
 	}
+}
 
-	rowsAffected, err := result.RowsAffected()
+func handlePatchCharacter(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
+
+		expand, err := parseExpand(c, characterRelations)
+
+		if err != nil {
+			return err
+		}
+
+		var stored *models.CharacterObject
+
+		err = transaction(c, s, func(tx *store.Store) error {
+			current, err := getCharacter(c, tx.Characters, id)
+
+			if err != nil {
+				return err
+			}
+
+			if err := checkIfMatch(c, characterETag(current)); err != nil {
+				return err
+			}
+
+			linkCharacter(c, current, expand)
+			character := characterFromObject(current)
+
+			if err := parsePatch(c, &character); err != nil {
+				return err
+			}
+
+			if err := checkCharacterReferences(c, tx, &character); err != nil {
+				return err
+			}
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to delete character",
+			if err := tx.Characters.Update(c.UserContext(), id, &character); err != nil {
+				return storeError(err, "Character not found")
+			}
+
+			stored, err = getCharacter(c, tx.Characters, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendCharacter(c, stored, expand)
 	}
+}
 
-	if rowsAffected == 0 {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+// getCharacter reads a character, reporting a missing one as not found
+func getCharacter(c *fiber.Ctx, characters store.CharacterStore, id int) (*models.CharacterObject, error) {
+	character, err := characters.Get(c.UserContext(), id)
 
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Character not found",
-		})
+	if err != nil {
+		return nil, storeError(err, "Character not found")
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Character deleted"})
+	return character, nil
 }
 
-func handleUpdateCharacter(c *fiber.Ctx) error {
-	// Get the id from params
-	id, err := c.ParamsInt("id")
+// sendCharacter responds with a character read from the store, so that
+// writes return the character in the same form as a GET for it
+func sendCharacter(c *fiber.Ctx, character *models.CharacterObject, expand map[string]bool) error {
+	linkCharacter(c, character, expand)
+	c.Set(fiber.HeaderETag, characterETag(character))
 
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
-		})
+	return c.JSON(character)
+}
+
+// checkCharacterVersion checks the If-Match header of a request against the
+// stored character
+func checkCharacterVersion(c *fiber.Ctx, characters store.CharacterStore, id int) error {
+	if !hasIfMatch(c) {
+		return nil
 	}
 
-	var character models.Character
-	err = c.BodyParser(&character)
+	current, err := getCharacter(c, characters, id)
 
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid data",
-		})
+		return err
 	}
 
-	db := database.Client
+	return checkIfMatch(c, characterETag(current))
+}
 
-	// Using parameterized queries to avoid escaping special characters like `'`
-	query := "UPDATE characters SET name = ?, species = ?, gender = ?, class = ? WHERE id = ?"
+// characterFromObject converts a character with its species and gender
+// inlined back to the form used to create and update it
+func characterFromObject(object *models.CharacterObject) models.Character {
+	return models.Character{
+		ID:      object.ID,
+		Name:    object.Name,
+		Species: object.SpeciesID(),
+		Gender:  object.GenderID(),
+		Class:   object.Class,
+		URL:     object.URL,
+	}
+}
 
-	stmt, err := db.Prepare(query)
+func handleRestoreCharacter(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
+
+		expand, err := parseExpand(c, characterRelations)
+
+		if err != nil {
+			return err
+		}
+
+		var stored *models.CharacterObject
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Internal server error",
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := tx.Characters.Restore(c.UserContext(), id); err != nil {
+				return storeError(err, "Deleted character not found")
+			}
+
+			stored, err = getCharacter(c, tx.Characters, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendCharacter(c, stored, expand)
 	}
+}
 
-	defer stmt.Close()
+// handleRevertCharacter updates a character to the state saved in one of its
+// revisions, restoring it first if it has been deleted
+func handleRevertCharacter(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	_, err = stmt.Exec(character.Name, character.Species, character.Gender, character.Class, id)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		expand, err := parseExpand(c, characterRelations)
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Internal server error",
+		if err != nil {
+			return err
+		}
+
+		var stored *models.CharacterObject
+
+		err = transaction(c, s, func(tx *store.Store) error {
+			var character models.Character
+
+			if err := parseRevisionRecord(c, tx.Revisions, store.ResourceCharacters, id, &character); err != nil {
+				return err
+			}
+
+			if err := checkCharacterReferences(c, tx, &character); err != nil {
+				return err
+			}
+
+			if err := checkCharacterVersion(c, tx.Characters, id); err != nil {
+				return err
+			}
+
+			if err := restoreForRevert(c, tx.Characters.Restore, id); err != nil {
+				return err
+			}
+
+			if err := tx.Characters.Update(c.UserContext(), id, &character); err != nil {
+				return storeError(err, "Character not found")
+			}
+
+			stored, err = getCharacter(c, tx.Characters, id)
+			return err
 		})
-	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Character updated"})
+		if err != nil {
+			return err
+		}
+
+		return sendCharacter(c, stored, expand)
+	}
 }
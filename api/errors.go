@@ -0,0 +1,26 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+	"github.com/njwong/me-api/validation"
+)
+
+// storeError converts an error returned by the store into a problem, where
+// notFound describes the record when it doesn't exist
+func storeError(err error, notFound string) error {
+	var missing *store.MissingReferenceError
+
+	switch {
+	case errors.As(err, &missing):
+		return problem.Validation([]validation.FieldError{{Field: missing.Field, Message: missing.Error()}})
+	case errors.Is(err, store.ErrNotFound):
+		return problem.NotFound(notFound)
+	case store.IsUnavailable(err):
+		return problem.Unavailable(err)
+	default:
+		return problem.Internal(err)
+	}
+}
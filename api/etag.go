@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/problem"
+)
+
+// etag returns a strong entity tag for the stored values of a resource. It
+// is a hash of the values rather than a version column, so it changes
+// whenever the resource does without needing to be stored.
+func etag(values ...any) string {
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+
+	return fmt.Sprintf("\"%x\"", sum[:12])
+}
+
+// characterETag covers the names of the species and gender too, as they are
+// part of the character returned by the API
+func characterETag(character *models.CharacterObject) string {
+	values := []any{character.ID, character.Name, character.Class}
+
+	if character.Species != nil {
+		values = append(values, character.Species.ID, character.Species.Name)
+	}
+
+	if character.Gender != nil {
+		values = append(values, character.Gender.ID, character.Gender.Name)
+	}
+
+	return etag(values...)
+}
+
+func genderETag(gender *models.Gender) string {
+	return etag(gender.ID, gender.Name)
+}
+
+func speciesETag(species *models.Species) string {
+	return etag(species.ID, species.Name)
+}
+
+// checkIfMatch returns a precondition failed problem if the request has an
+// If-Match header that doesn't include current, the ETag of the resource as
+// it is stored now. Requests without If-Match are always allowed.
+func checkIfMatch(c *fiber.Ctx, current string) error {
+	header := c.Get(fiber.HeaderIfMatch)
+
+	if header == "" {
+		return nil
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		// Weak tags never match, If-Match needs a strong comparison
+		if tag == "*" || tag == current {
+			return nil
+		}
+	}
+
+	return problem.PreconditionFailed("The resource has been changed since it was last read")
+}
+
+// hasIfMatch reports whether the request is conditional on the resource's version
+func hasIfMatch(c *fiber.Ctx) bool {
+	return c.Get(fiber.HeaderIfMatch) != ""
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"bufio"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/njwong/me-api/exporter"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+// ExportsPerMinute is how many exports a client can start each minute on
+// the public route, as each one reads the whole dataset
+const ExportsPerMinute = 5
+
+func AddExportRoutes(app *fiber.App, s *store.Store) {
+	apiGroup := app.Group("/api")
+	apiGroup.Get("/export", exportLimiter(), handleExport(s, false))
+}
+
+// exportLimiter limits how often each client can start an export. Requests
+// for deleted records are skipped, as they need admin authentication.
+func exportLimiter() fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        ExportsPerMinute,
+		Expiration: time.Minute,
+		Next: func(c *fiber.Ctx) bool {
+			includeDeleted, err := strconv.ParseBool(c.Query("include_deleted", "false"))
+			return err == nil && includeDeleted
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return problem.TooManyRequests()
+		},
+	})
+}
+
+func AddAdminExportRoutes(app *fiber.App, s *store.Store) {
+	apiGroup := app.Group("/api")
+	apiGroup.Get("/export", handleExport(s, true))
+}
+
+// handleExport streams the whole dataset in the format given by the format
+// parameter, json by default. Deleted records are included with
+// include_deleted, which is only served on the admin route, when admin is
+// set. The status and headers are sent before the records are read, so an
+// error part way through can only be logged, and leaves the export cut
+// short.
+func handleExport(s *store.Store, admin bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		format := exporter.Format(c.Query("format", string(exporter.JSON)))
+
+		if !containsFormat(exporter.Formats, format) {
+			return problem.BadRequest("Invalid format")
+		}
+
+		includeDeleted, err := strconv.ParseBool(c.Query("include_deleted", "false"))
+
+		if err != nil {
+			return problem.BadRequest("Invalid include_deleted")
+		}
+
+		// Hand requests for deleted records on to the admin route, which
+		// requires a token
+		if includeDeleted && !admin {
+			return c.Next()
+		}
+
+		ctx := c.UserContext()
+		exportedAt := time.Now().UTC()
+
+		c.Set(fiber.HeaderContentType, exporter.ContentType(format))
+		c.Set(fiber.HeaderContentDisposition, "attachment; filename=\"me-api-export."+string(format)+"\"")
+		c.Set("X-Schema-Version", strconv.Itoa(exporter.SchemaVersion))
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			if err := exporter.Write(ctx, w, s, format, exportedAt, includeDeleted); err != nil {
+				log.Printf("(api) export failed - %v", err)
+			}
+		})
+
+		return nil
+	}
+}
+
+func containsFormat(formats []exporter.Format, target exporter.Format) bool {
+	for _, format := range formats {
+		if format == target {
+			return true
+		}
+	}
+
+	return false
+}
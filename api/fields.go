@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+// Fields each resource can be sorted by
+var (
+	characterSortFields = []string{"id", "name", "species", "gender", "class"}
+	genderSortFields    = []string{"id", "name"}
+	speciesSortFields   = []string{"id", "name"}
+)
+
+// Fields each resource can be selected with ?fields=
+var (
+	characterFields = []string{"id", "name", "species", "gender", "class", "url", "deleted_at"}
+	genderFields    = []string{"id", "name", "url", "deleted_at"}
+	speciesFields   = []string{"id", "name", "url", "deleted_at"}
+)
+
+// Related resources that can be inlined with ?expand=
+var characterRelations = []string{"species", "gender"}
+
+// parseExpand reads the expand parameter, e.g. "species,gender". Without it
+// every relation is inlined, otherwise only the listed ones are and the rest
+// are returned as links.
+func parseExpand(c *fiber.Ctx, relations []string) (map[string]bool, error) {
+	expand := map[string]bool{}
+
+	if !c.Context().QueryArgs().Has("expand") {
+		for _, relation := range relations {
+			expand[relation] = true
+		}
+
+		return expand, nil
+	}
+
+	for _, name := range strings.Split(c.Query("expand"), ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		if !contains(relations, name) {
+			return nil, problem.BadRequest("Invalid expand " + name)
+		}
+
+		expand[name] = true
+	}
+
+	return expand, nil
+}
+
+// parseListOptions reads the pagination, sort and include_deleted query
+// parameters for a list endpoint, where sortable lists the fields the
+// resource can be sorted by
+func parseListOptions(c *fiber.Ctx, sortable []string) (store.ListOptions, error) {
+	opts, err := parsePagination(c)
+
+	if err != nil {
+		return opts, err
+	}
+
+	opts.Sort, err = parseSort(c.Query("sort"), sortable)
+
+	if err != nil {
+		return opts, err
+	}
+
+	if len(opts.Sort) > 0 && usesCursor(opts) {
+		return opts, problem.BadRequest("Sort can't be used with after or before")
+	}
+
+	if raw := c.Query("include_deleted"); raw != "" {
+		opts.IncludeDeleted, err = strconv.ParseBool(raw)
+
+		if err != nil {
+			return opts, problem.BadRequest("Invalid include_deleted")
+		}
+	}
+
+	return opts, nil
+}
+
+// parseSort parses a sort parameter like "name,-id", where a leading "-"
+// sorts that field in descending order
+func parseSort(value string, allowed []string) ([]store.SortField, error) {
+	fields := []store.SortField{}
+
+	if value == "" {
+		return fields, nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		field := store.SortField{Field: strings.TrimSpace(name)}
+
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field = field.Field[1:]
+			field.Descending = true
+		}
+
+		if !contains(allowed, field.Field) {
+			return nil, problem.BadRequest("Invalid sort field " + field.Field)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// parseFields parses a fields parameter like "id,name". An empty result
+// means every field should be returned.
+func parseFields(c *fiber.Ctx, allowed []string) ([]string, error) {
+	fields := []string{}
+
+	value := c.Query("fields")
+
+	if value == "" {
+		return fields, nil
+	}
+
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+
+		if !contains(allowed, name) {
+			return nil, problem.BadRequest("Invalid field " + name)
+		}
+
+		fields = append(fields, name)
+	}
+
+	return fields, nil
+}
+
+// sendPage responds with a page of results, trimmed to the requested fields
+func sendPage[T any](c *fiber.Ctx, response page[T], fields []string) error {
+	if len(fields) == 0 {
+		return c.JSON(response)
+	}
+
+	results, err := selectFields(response.Results, fields)
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	return c.JSON(page[map[string]json.RawMessage]{
+		Count:    response.Count,
+		Next:     response.Next,
+		Previous: response.Previous,
+		Results:  results,
+	})
+}
+
+// selectFields converts records to JSON objects containing only the given fields
+func selectFields[T any](records []T, fields []string) ([]map[string]json.RawMessage, error) {
+	selected := []map[string]json.RawMessage{}
+
+	for _, record := range records {
+		data, err := json.Marshal(record)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]json.RawMessage
+
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+
+		object := map[string]json.RawMessage{}
+
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				object[field] = value
+			}
+		}
+
+		selected = append(selected, object)
+	}
+
+	return selected, nil
+}
+
+func contains(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+
+	return false
+}
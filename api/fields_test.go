@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// newCharacters creates a store with characters 1 to 4, Garrus, Liara,
+// Saren and Aria
+func newCharacters(t *testing.T) *store.Store {
+	t.Helper()
+
+	ctx := context.Background()
+	s := store.NewMemory()
+
+	mustDo(t, s.Species.Create(ctx, &models.Species{Name: "Turian"}))
+	mustDo(t, s.Species.Create(ctx, &models.Species{Name: "Asari"}))
+	mustDo(t, s.Genders.Create(ctx, &models.Gender{Name: "Male"}))
+	mustDo(t, s.Genders.Create(ctx, &models.Gender{Name: "Female"}))
+
+	for _, character := range []models.Character{
+		{Name: "Garrus", Species: 1, Gender: 1, Class: "Sniper"},
+		{Name: "Liara", Species: 2, Gender: 2, Class: "Adept"},
+		{Name: "Saren", Species: 1, Gender: 1, Class: "Spectre"},
+		{Name: "Aria", Species: 2, Gender: 2, Class: "Biotic"},
+	} {
+		character := character
+		mustDo(t, s.Characters.Create(ctx, &character))
+	}
+
+	return s
+}
+
+func TestSort(t *testing.T) {
+	app := newApp(newCharacters(t))
+
+	tests := []struct {
+		sort string
+		ids  []int
+	}{
+		{"", []int{1, 2, 3, 4}},
+		{"name", []int{4, 1, 2, 3}},
+		{"-name", []int{3, 2, 1, 4}},
+		{"-id", []int{4, 3, 2, 1}},
+		{"class", []int{2, 4, 1, 3}},
+		{"species,-id", []int{4, 2, 3, 1}},
+		{"gender,name", []int{4, 2, 1, 3}},
+		{"%20name%20,%20-id%20", []int{4, 1, 2, 3}},
+	}
+
+	for _, test := range tests {
+		response := list(t, app, "/api/characters?sort="+test.sort)
+
+		if !reflect.DeepEqual(response.ids(), test.ids) {
+			t.Errorf("sorting by %q gave %v, want %v", test.sort, response.ids(), test.ids)
+		}
+	}
+
+	// Sorted pages follow on from each other with offsets
+	response := list(t, app, "/api/characters?sort=name&limit=2&offset=2")
+
+	if !reflect.DeepEqual(response.ids(), []int{2, 3}) || deref(response.Previous) != "http://example.com/api/characters?limit=2&sort=name" {
+		t.Errorf("second sorted page gave %v, previous %q", response.ids(), deref(response.Previous))
+	}
+}
+
+func TestFields(t *testing.T) {
+	app := newApp(newCharacters(t))
+
+	tests := []struct {
+		url    string
+		fields []string
+	}{
+		{"/api/characters?fields=id,name", []string{"id", "name"}},
+		{"/api/characters?fields=name,%20species", []string{"name", "species"}},
+		{"/api/characters?fields=url&expand=", []string{"url"}},
+		{"/api/genders?fields=name", []string{"name"}},
+		{"/api/species?fields=id,url", []string{"id", "url"}},
+		{"/api/species", []string{"id", "name", "url"}},
+	}
+
+	for _, test := range tests {
+		response := list(t, app, test.url)
+
+		if len(response.Results) != response.Count {
+			t.Fatalf("%s gave %d of %d results", test.url, len(response.Results), response.Count)
+		}
+
+		for _, result := range response.Results {
+			got := []string{}
+
+			for field := range result {
+				got = append(got, field)
+			}
+
+			sort.Strings(got)
+
+			want := append([]string{}, test.fields...)
+			sort.Strings(want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s gave fields %v, want %v", test.url, got, want)
+			}
+		}
+	}
+
+	// Relations keep their form when they are selected
+	response := list(t, app, "/api/characters?fields=species&expand=gender&limit=1")
+
+	if link, ok := response.Results[0]["species"].(string); !ok || link != "http://example.com/api/species/1" {
+		t.Errorf("got species %v, want a link as it isn't expanded", response.Results[0]["species"])
+	}
+}
+
+func TestSortAndFieldsInvalid(t *testing.T) {
+	app := newApp(newCharacters(t))
+
+	for _, url := range []string{
+		"/api/characters?sort=url",
+		"/api/characters?sort=-",
+		"/api/characters?sort=name,",
+		"/api/genders?sort=class",
+		"/api/characters?fields=password",
+		"/api/characters?fields=id,",
+		"/api/species?fields=class",
+		"/api/characters?expand=class",
+	} {
+		resp, body := request(t, app, fiber.MethodGet, url, "")
+
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%s gave %d: %s", url, resp.StatusCode, body)
+		}
+	}
+}
@@ -1,231 +1,345 @@
 package api
 
 import (
-	"fmt"
-
 	"github.com/gofiber/fiber/v2"
-	"github.com/njwong/me-api/database"
 	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
 )
 
-func AddGendersEndpoints(app *fiber.App) {
+func AddGendersEndpoints(app *fiber.App, s *store.Store) {
 	apiGroup := app.Group("/api")
 
-	apiGroup.Get("/genders", handleGetGenders)
-	apiGroup.Get("/genders/:id", handleGetGender)
+	apiGroup.Get("/genders", handleGetGenders(s.Genders, s.Audit, false))
+	apiGroup.Get("/genders/:id", handleGetGender(s.Genders, s.Audit))
+	apiGroup.Get("/genders/:id/revisions", handleGetRevisions(s, store.ResourceGenders, "Gender not found", false))
+	apiGroup.Get("/genders/:id/revisions/:rev", handleGetRevision(s, store.ResourceGenders, false))
 }
 
-func AddAdminGendersEndpoints(app *fiber.App) {
+func AddAdminGendersEndpoints(app *fiber.App, s *store.Store) {
 	apiGroup := app.Group("/api")
 
-	apiGroup.Post("/genders", handleCreateGender)
-	apiGroup.Put("/genders/:id", handleUpdateGender)
-	apiGroup.Delete("/genders/:id", handleDeleteGender)
+	apiGroup.Get("/genders", handleGetGenders(s.Genders, s.Audit, true))
+	apiGroup.Get("/genders/:id/revisions", handleGetRevisions(s, store.ResourceGenders, "Gender not found", true))
+	apiGroup.Get("/genders/:id/revisions/:rev", handleGetRevision(s, store.ResourceGenders, true))
+	apiGroup.Post("/genders", handleCreateGender(s))
+	apiGroup.Put("/genders/:id", handleUpdateGender(s))
+	apiGroup.Patch("/genders/:id", handlePatchGender(s))
+	apiGroup.Delete("/genders/:id", handleDeleteGender(s))
+	apiGroup.Post("/genders/:id/restore", handleRestoreGender(s))
+	apiGroup.Post("/genders/:id/revert/:rev", handleRevertGender(s))
 }
 
-func handleGetGenders(c *fiber.Ctx) error {
-	db := database.Client
+// handleGetGenders lists genders. Deleted ones are only included on the
+// admin route, when admin is set.
+func handleGetGenders(genders store.GenderStore, audit store.AuditStore, admin bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		opts, err := parseListOptions(c, genderSortFields)
 
-	query := "SELECT * FROM genders"
+		if err != nil {
+			return err
+		}
 
-	res, err := db.Query(query)
+		// Hand requests for deleted records on to the admin route, which
+		// requires a token
+		if opts.IncludeDeleted && !admin {
+			return c.Next()
+		}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		fields, err := parseFields(c, genderFields)
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Internal server error",
-		})
-	}
+		if err != nil {
+			return err
+		}
 
-	defer res.Close()
+		genderList, total, err := genders.List(c.UserContext(), pageOptions(opts))
 
-	genders := []models.Gender{}
+		if err != nil {
+			return storeError(err, "Gender not found")
+		}
 
-	for res.Next() {
-		var gender models.Gender
+		for i := range genderList {
+			genderList[i].URL = resourceURL(c, store.ResourceGenders, genderList[i].ID)
+		}
+
+		if err := setLastModified(c, audit, changed{resource: store.ResourceGenders}); err != nil {
+			return err
+		}
+
+		response := newPage(c, opts, genderList, total, func(gender models.Gender) int { return gender.ID })
+
+		return sendPage(c, response, fields)
+	}
+}
+
+func handleGetGender(genders store.GenderStore, audit store.AuditStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
+
+		if err != nil {
+			return err
+		}
 
-		err := res.Scan(&gender.ID, &gender.Name)
+		gender, err := getGender(c, genders, id)
 
 		if err != nil {
-			fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			return err
+		}
 
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"msg": "Internal server error",
-			})
+		if err := setLastModified(c, audit, changed{resource: store.ResourceGenders, id: gender.ID}); err != nil {
+			return err
 		}
 
-		genders = append(genders, gender)
+		return sendGender(c, gender)
 	}
-
-	return c.JSON(genders)
 }
 
-func handleGetGender(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+func handleCreateGender(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var gender models.Gender
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err := parseBody(c, &gender); err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
+		var stored *models.Gender
+
+		err := transaction(c, s, func(tx *store.Store) error {
+			if err := tx.Genders.Create(c.UserContext(), &gender); err != nil {
+				return storeError(err, "Gender not found")
+			}
+
+			var err error
+			stored, err = getGender(c, tx.Genders, gender.ID)
+			return err
 		})
-	}
 
-	gender, err := findGenderByID(id)
+		if err != nil {
+			return err
+		}
 
-	if gender == nil || err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		c.Location(resourceURL(c, store.ResourceGenders, gender.ID))
+		c.Status(fiber.StatusCreated)
 
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Gender not found",
-		})
+		return sendGender(c, stored)
 	}
-
-	return c.JSON(gender)
 }
 
-func findGenderByID(id int) (*models.Gender, error) {
-	db := database.Client
+func handleUpdateGender(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	var gender models.Gender
+		if err != nil {
+			return err
+		}
 
-	query := fmt.Sprintf("SELECT * FROM genders WHERE id = %d", id)
-	err := db.QueryRow(query).Scan(&gender.ID, &gender.Name)
+		var stored *models.Gender
 
-	return &gender, err
-}
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := checkGenderVersion(c, tx.Genders, id); err != nil {
+				return err
+			}
 
-func handleCreateGender(c *fiber.Ctx) error {
-	var gender models.Gender
+			var gender models.Gender
 
-	err := c.BodyParser(&gender)
+			if err := parseBody(c, &gender); err != nil {
+				return err
+			}
 
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
+			if err := tx.Genders.Update(c.UserContext(), id, &gender); err != nil {
+				return storeError(err, "Gender not found")
+			}
+
+			stored, err = getGender(c, tx.Genders, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendGender(c, stored)
 	}
+}
 
-	db := database.Client
+func handleDeleteGender(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	query := fmt.Sprintf("INSERT INTO genders (name) VALUES (\"%s\")", gender.Name)
+		if err != nil {
+			return err
+		}
 
-	result, err := db.Exec(query)
+		opts, err := parseDeleteOptions(c)
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create gender",
-		})
-	}
+		if err != nil {
+			return err
+		}
 
-	id, err := result.LastInsertId()
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := checkGenderVersion(c, tx.Genders, id); err != nil {
+				return err
+			}
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get gender ID",
+			if err := tx.Genders.Delete(c.UserContext(), id, opts); err != nil {
+				return deleteError(c, err, "gender", "Gender not found")
+			}
+
+			return nil
 		})
-	}
 
-	gender.ID = int(id)
-	return c.Status(fiber.StatusCreated).JSON(gender)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Gender deleted"})
+	}
 }
 
-func handleUpdateGender(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+func handlePatchGender(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
-		})
-	}
+		var stored *models.Gender
 
-	var gender models.Gender
-	err = c.BodyParser(&gender)
+		err = transaction(c, s, func(tx *store.Store) error {
+			gender, err := getGender(c, tx.Genders, id)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			if err != nil {
+				return err
+			}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid data",
-		})
-	}
+			if err := checkIfMatch(c, genderETag(gender)); err != nil {
+				return err
+			}
 
-	db := database.Client
+			gender.URL = resourceURL(c, store.ResourceGenders, gender.ID)
 
-	query := fmt.Sprintf("UPDATE genders SET name = '%s' WHERE id = %d", gender.Name, id)
+			if err := parsePatch(c, gender); err != nil {
+				return err
+			}
 
-	result, err := db.Exec(query)
+			if err := tx.Genders.Update(c.UserContext(), id, gender); err != nil {
+				return storeError(err, "Gender not found")
+			}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
-
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to update gender",
+			stored, err = getGender(c, tx.Genders, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendGender(c, stored)
 	}
+}
 
-	rowsAffected, err := result.RowsAffected()
+// getGender reads a gender, reporting a missing one as not found
+func getGender(c *fiber.Ctx, genders store.GenderStore, id int) (*models.Gender, error) {
+	gender, err := genders.Get(c.UserContext(), id)
 
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to update gender",
-		})
+		return nil, storeError(err, "Gender not found")
 	}
 
-	if rowsAffected == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Gender not found",
-		})
-	}
+	return gender, nil
+}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Gender updated"})
+// sendGender responds with a gender read from the store, so that writes
+// return the gender in the same form as a GET for it
+func sendGender(c *fiber.Ctx, gender *models.Gender) error {
+	gender.URL = resourceURL(c, store.ResourceGenders, gender.ID)
+	c.Set(fiber.HeaderETag, genderETag(gender))
+
+	return c.JSON(gender)
 }
 
-func handleDeleteGender(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+// checkGenderVersion checks the If-Match header of a request against the
+// stored gender
+func checkGenderVersion(c *fiber.Ctx, genders store.GenderStore, id int) error {
+	if !hasIfMatch(c) {
+		return nil
+	}
+
+	current, err := getGender(c, genders, id)
 
 	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
-
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
-		})
+		return err
 	}
 
-	db := database.Client
+	return checkIfMatch(c, genderETag(current))
+}
 
-	query := fmt.Sprintf("DELETE FROM genders WHERE id = %d", id)
+func handleRestoreGender(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	result, err := db.Exec(query)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		var stored *models.Gender
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to delete gender",
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := tx.Genders.Restore(c.UserContext(), id); err != nil {
+				return storeError(err, "Deleted gender not found")
+			}
+
+			stored, err = getGender(c, tx.Genders, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendGender(c, stored)
 	}
+}
 
-	rowsAffected, err := result.RowsAffected()
+// handleRevertGender updates a gender to the state saved in one of its
+// revisions, restoring it first if it has been deleted
+func handleRevertGender(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to delete gender",
-		})
-	}
+		var stored *models.Gender
+
+		err = transaction(c, s, func(tx *store.Store) error {
+			var gender models.Gender
+
+			if err := parseRevisionRecord(c, tx.Revisions, store.ResourceGenders, id, &gender); err != nil {
+				return err
+			}
+
+			if err := checkGenderVersion(c, tx.Genders, id); err != nil {
+				return err
+			}
 
-	if rowsAffected == 0 {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			if err := restoreForRevert(c, tx.Genders.Restore, id); err != nil {
+				return err
+			}
 
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Gender not found",
+			if err := tx.Genders.Update(c.UserContext(), id, &gender); err != nil {
+				return storeError(err, "Gender not found")
+			}
+
+			stored, err = getGender(c, tx.Genders, id)
+			return err
 		})
-	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Gender deleted"})
+		if err != nil {
+			return err
+		}
+
+		return sendGender(c, stored)
+	}
 }
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/importer"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+func AddAdminImportRoutes(app *fiber.App, s *store.Store) {
+	apiGroup := app.Group("/api")
+	apiGroup.Post("/admin/import", handleImport(s))
+}
+
+// handleImport imports the records in the request body into the resource
+// named by the resource parameter, all or nothing. The body is CSV, a JSON
+// array or NDJSON, depending on its content type. With dry_run=true the
+// report of what would change is returned without writing anything.
+func handleImport(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		resource := c.Query("resource")
+
+		if !contains(importer.Resources, resource) {
+			return problem.BadRequest("Invalid resource")
+		}
+
+		dryRun := false
+
+		if raw := c.Query("dry_run"); raw != "" {
+			var err error
+			dryRun, err = strconv.ParseBool(raw)
+
+			if err != nil {
+				return problem.BadRequest("Invalid dry_run")
+			}
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+		format, ok := importer.FormatForMediaType(mediaType)
+
+		if !ok {
+			return problem.UnsupportedMediaType("Imports must be sent as text/csv, application/json or application/x-ndjson")
+		}
+
+		rows, err := importer.Parse(bytes.NewReader(c.Body()), format)
+
+		if err != nil {
+			return problem.BadRequest("Invalid import - " + err.Error())
+		}
+
+		report, err := importer.Run(c.UserContext(), s, resource, rows, dryRun)
+
+		if errors.Is(err, importer.ErrInvalidRows) {
+			return problem.Validation(report.Errors)
+		}
+
+		if err != nil {
+			return storeError(err, "")
+		}
+
+		return c.JSON(report)
+	}
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/store"
+)
+
+// changed selects the audit log entries of a record, or of every record of
+// the resource when id is 0
+type changed struct {
+	resource string
+	id       int
+}
+
+// setLastModified sets Last-Modified to the time of the latest audit log
+// entry for any of the records, which middleware.Conditional uses to answer
+// If-Modified-Since. Lists are given whole resources, as a record that has
+// been deleted changes the list without being served. Nothing is set when
+// the records have no entries, such as data loaded before the audit log.
+func setLastModified(c *fiber.Ctx, audit store.AuditStore, records ...changed) error {
+	var latest time.Time
+
+	for _, record := range records {
+		filter := store.AuditFilter{Resource: record.resource, ResourceID: record.id}
+		opts := store.ListOptions{Sort: []store.SortField{{Field: "id", Descending: true}}, Limit: 1}
+
+		entries, _, err := audit.List(c.UserContext(), filter, opts)
+
+		if err != nil {
+			return storeError(err, "")
+		}
+
+		if len(entries) > 0 && entries[0].Time.After(latest) {
+			latest = entries[0].Time
+		}
+	}
+
+	if !latest.IsZero() {
+		c.Set(fiber.HeaderLastModified, latest.UTC().Format(http.TimeFormat))
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// page is the envelope returned by the list endpoints
+type page[T any] struct {
+	Count    int     `json:"count"`
+	Next     *string `json:"next"`
+	Previous *string `json:"previous"`
+	Results  []T     `json:"results"`
+}
+
+// parsePagination reads the limit, offset, after and before query parameters.
+// Offsets and cursors can't be combined, and only one cursor can be used.
+func parsePagination(c *fiber.Ctx) (store.ListOptions, error) {
+	opts := store.ListOptions{Limit: defaultPageLimit}
+
+	params := []struct {
+		name  string
+		value *int
+		min   int
+	}{
+		{"limit", &opts.Limit, 1},
+		{"offset", &opts.Offset, 0},
+		{"after", &opts.After, 1},
+		{"before", &opts.Before, 1},
+	}
+
+	for _, param := range params {
+		raw := c.Query(param.name)
+
+		if raw == "" {
+			continue
+		}
+
+		value, err := strconv.Atoi(raw)
+
+		if err != nil || value < param.min {
+			return opts, problem.BadRequest("Invalid " + param.name)
+		}
+
+		*param.value = value
+	}
+
+	if opts.Limit > maxPageLimit {
+		opts.Limit = maxPageLimit
+	}
+
+	if opts.After > 0 && opts.Before > 0 {
+		return opts, problem.BadRequest("After and before can't be used together")
+	}
+
+	if opts.Offset > 0 && (opts.After > 0 || opts.Before > 0) {
+		return opts, problem.BadRequest("Offset can't be used with after or before")
+	}
+
+	return opts, nil
+}
+
+// usesCursor reports whether the page is selected by after or before
+func usesCursor(opts store.ListOptions) bool {
+	return opts.After > 0 || opts.Before > 0
+}
+
+// pageOptions returns the options to pass to the store. Cursor pages fetch
+// one extra record to find out whether there is another page beyond them.
+func pageOptions(opts store.ListOptions) store.ListOptions {
+	if usesCursor(opts) {
+		opts.Limit++
+	}
+
+	return opts
+}
+
+// newPage wraps the results of a list call in the page envelope, linking to
+// the neighbouring pages using the same style of pagination as the request
+func newPage[T any](c *fiber.Ctx, opts store.ListOptions, results []T, total int, id func(T) int) page[T] {
+	response := page[T]{Count: total, Results: results}
+
+	if !usesCursor(opts) {
+		if opts.Offset+len(results) < total {
+			response.Next = pageURL(c, "offset", opts.Offset+opts.Limit)
+		}
+
+		if opts.Offset > 0 {
+			previous := opts.Offset - opts.Limit
+
+			if previous < 0 {
+				previous = 0
+			}
+
+			response.Previous = pageURL(c, "offset", previous)
+		}
+
+		return response
+	}
+
+	// Drop the extra record fetched by pageOptions
+	more := len(results) > opts.Limit
+
+	if more {
+		if opts.Before > 0 {
+			results = results[1:]
+		} else {
+			results = results[:opts.Limit]
+		}
+	}
+
+	response.Results = results
+
+	if len(results) == 0 {
+		return response
+	}
+
+	first := id(results[0])
+	last := id(results[len(results)-1])
+
+	// The cursor itself came from a neighbouring page, so there is always a
+	// page on that side of it
+	if opts.After > 0 {
+		response.Previous = pageURL(c, "before", first)
+
+		if more {
+			response.Next = pageURL(c, "after", last)
+		}
+	} else {
+		response.Next = pageURL(c, "after", last)
+
+		if more {
+			response.Previous = pageURL(c, "before", first)
+		}
+	}
+
+	return response
+}
+
+// pageURL returns the current request URL with its pagination parameters
+// replaced by the given one
+func pageURL(c *fiber.Ctx, param string, value int) *string {
+	query, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+
+	query.Del("offset")
+	query.Del("after")
+	query.Del("before")
+
+	if param != "offset" || value > 0 {
+		query.Set(param, strconv.Itoa(value))
+	}
+
+	link := baseURL(c) + c.Path()
+
+	if len(query) > 0 {
+		link += "?" + query.Encode()
+	}
+
+	return &link
+}
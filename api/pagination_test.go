@@ -0,0 +1,135 @@
+package api_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// newGenders creates a store with genders 1 to 5
+func newGenders(t *testing.T) *store.Store {
+	t.Helper()
+
+	s := store.NewMemory()
+
+	for _, name := range []string{"Male", "Female", "Genderless", "Agender", "Unknown"} {
+		mustDo(t, s.Genders.Create(context.Background(), &models.Gender{Name: name}))
+	}
+
+	return s
+}
+
+func link(query string) string {
+	return "http://example.com/api/genders?" + query
+}
+
+func TestPagination(t *testing.T) {
+	app := newApp(newGenders(t))
+
+	tests := []struct {
+		query    string
+		ids      []int
+		next     string
+		previous string
+	}{
+		{"", []int{1, 2, 3, 4, 5}, "", ""},
+		{"limit=1000", []int{1, 2, 3, 4, 5}, "", ""},
+		{"limit=2", []int{1, 2}, link("limit=2&offset=2"), ""},
+		{"limit=2&offset=2", []int{3, 4}, link("limit=2&offset=4"), link("limit=2")},
+		{"limit=2&offset=4", []int{5}, "", link("limit=2&offset=2")},
+		{"limit=2&offset=1", []int{2, 3}, link("limit=2&offset=3"), link("limit=2")},
+		{"limit=2&offset=9", []int{}, "", link("limit=2&offset=7")},
+		{"limit=2&after=1", []int{2, 3}, link("after=3&limit=2"), link("before=2&limit=2")},
+		{"limit=2&after=3", []int{4, 5}, "", link("before=4&limit=2")},
+		{"limit=2&after=5", []int{}, "", ""},
+		{"limit=2&before=5", []int{3, 4}, link("after=4&limit=2"), link("before=3&limit=2")},
+		{"limit=2&before=3", []int{1, 2}, link("after=2&limit=2"), ""},
+		{"limit=2&after=1&name=kept", []int{2, 3}, link("after=3&limit=2&name=kept"), link("before=2&limit=2&name=kept")},
+	}
+
+	for _, test := range tests {
+		response := list(t, app, "/api/genders?"+test.query)
+
+		if response.Count != 5 || !reflect.DeepEqual(response.ids(), test.ids) {
+			t.Errorf("%q gave count %d and IDs %v, want %v", test.query, response.Count, response.ids(), test.ids)
+		}
+
+		if next := deref(response.Next); next != test.next {
+			t.Errorf("%q gave next %q, want %q", test.query, next, test.next)
+		}
+
+		if previous := deref(response.Previous); previous != test.previous {
+			t.Errorf("%q gave previous %q, want %q", test.query, previous, test.previous)
+		}
+	}
+}
+
+// TestPaginationFollowsLinks walks every page in both directions
+func TestPaginationFollowsLinks(t *testing.T) {
+	app := newApp(newGenders(t))
+
+	// Offsets and cursors, starting after the first gender
+	for start, ids := range map[string][]int{
+		"/api/genders?limit=2":         {},
+		"/api/genders?limit=2&after=1": {1},
+	} {
+		url := start
+
+		for url != "" {
+			response := list(t, app, url)
+			ids = append(ids, response.ids()...)
+			url = deref(response.Next)
+		}
+
+		if !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 5}) {
+			t.Errorf("following next from %s gave %v", start, ids)
+		}
+	}
+
+	ids := []int{}
+	url := "/api/genders?limit=2&before=6"
+
+	for url != "" {
+		response := list(t, app, url)
+		ids = append(response.ids(), ids...)
+		url = deref(response.Previous)
+	}
+
+	if !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("following previous gave %v", ids)
+	}
+}
+
+func TestPaginationInvalid(t *testing.T) {
+	app := newApp(newGenders(t))
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=x",
+		"offset=-1",
+		"after=0&limit=2",
+		"before=-1",
+		"after=1&before=3",
+		"offset=1&after=1",
+		"offset=1&before=3",
+		"sort=name&after=1",
+	} {
+		resp, body := request(t, app, fiber.MethodGet, "/api/genders?"+query, "")
+
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("%q gave %d: %s", query, resp.StatusCode, body)
+		}
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
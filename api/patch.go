@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime"
+	"reflect"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/patch"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/validation"
+)
+
+// Fields that are part of a patched document but can't be changed
+var readOnlyFields = []string{"id", "url", "deleted_at"}
+
+// parsePatch applies the patch in the request body to record, which must be
+// a pointer to the current state of the resource. The body can be either a
+// JSON Merge Patch or a JSON Patch, depending on its content type, and the
+// patched record is validated in the same way as a full update.
+func parsePatch(c *fiber.Ctx, record any) error {
+	document, err := json.Marshal(record)
+
+	if err != nil {
+		return problem.Internal(err)
+	}
+
+	var patched []byte
+
+	mediaType, _, _ := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+
+	switch mediaType {
+	case patch.MergePatchType:
+		patched, err = patch.Merge(document, c.Body())
+	case patch.JSONPatchType:
+		patched, err = patch.Apply(document, c.Body())
+	default:
+		c.Set("Accept-Patch", patch.MergePatchType+", "+patch.JSONPatchType)
+
+		return problem.UnsupportedMediaType("Patches must be sent as " + patch.MergePatchType + " or " + patch.JSONPatchType)
+	}
+
+	if errors.Is(err, patch.ErrTestFailed) {
+		return problem.Conflict("Invalid patch - " + err.Error())
+	}
+
+	if err != nil {
+		return problem.BadRequest("Invalid patch - " + err.Error())
+	}
+
+	fieldErrors := readOnlyErrors(document, patched)
+
+	// Start from an empty record so that removed fields are cleared
+	reflect.ValueOf(record).Elem().SetZero()
+
+	decodeErrors, err := decodeJSON(patched, record)
+
+	if err != nil {
+		return problem.BadRequest("Invalid patch - the result must be an object")
+	}
+
+	fieldErrors = append(fieldErrors, decodeErrors...)
+
+	if len(fieldErrors) > 0 {
+		return problem.Validation(fieldErrors)
+	}
+
+	return nil
+}
+
+// readOnlyErrors reports the read-only fields that a patch changed
+func readOnlyErrors(original, patched []byte) []validation.FieldError {
+	fieldErrors := []validation.FieldError{}
+
+	var before, after map[string]json.RawMessage
+
+	// A patch that doesn't result in an object is reported when decoding it
+	if json.Unmarshal(original, &before) != nil || json.Unmarshal(patched, &after) != nil {
+		return fieldErrors
+	}
+
+	for _, field := range readOnlyFields {
+		if !bytes.Equal(before[field], after[field]) {
+			fieldErrors = append(fieldErrors, validation.FieldError{Field: field, Message: "is read-only"})
+		}
+	}
+
+	return fieldErrors
+}
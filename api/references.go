@@ -0,0 +1,80 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+	"github.com/njwong/me-api/validation"
+)
+
+// Policies accepted by the references parameter when deleting a species or gender
+var referencePolicies = []string{
+	string(store.Restrict),
+	string(store.Nullify),
+	string(store.Reassign),
+}
+
+// parseDeleteOptions reads how to treat the characters that refer to a
+// deleted species or gender, from ?references=restrict|nullify|reassign and
+// the ?replacement= ID that reassign requires
+func parseDeleteOptions(c *fiber.Ctx) (store.DeleteOptions, error) {
+	opts := store.DeleteOptions{Policy: store.Restrict}
+
+	if raw := c.Query("references"); raw != "" {
+		if !contains(referencePolicies, raw) {
+			return opts, problem.BadRequest("Invalid references")
+		}
+
+		opts.Policy = store.ReferencePolicy(raw)
+	}
+
+	raw := c.Query("replacement")
+
+	if opts.Policy != store.Reassign {
+		if raw != "" {
+			return opts, problem.BadRequest("Replacement can only be used with references=reassign")
+		}
+
+		return opts, nil
+	}
+
+	replacement, err := strconv.Atoi(raw)
+
+	if err != nil || replacement < 1 {
+		return opts, problem.BadRequest("Invalid replacement")
+	}
+
+	opts.ReplacementID = replacement
+	return opts, nil
+}
+
+// deleteError converts an error from deleting a species or gender into a
+// problem. Characters that still refer to the record are listed by URL.
+func deleteError(c *fiber.Ctx, err error, resource string, notFound string) error {
+	var referenced *store.ReferencedError
+
+	switch {
+	case errors.As(err, &referenced):
+		p := problem.Conflict(fmt.Sprintf(
+			"%d characters refer to this %s, use references=nullify or references=reassign to delete it anyway",
+			len(referenced.CharacterIDs), resource,
+		))
+
+		for _, id := range referenced.CharacterIDs {
+			p.References = append(p.References, resourceURL(c, store.ResourceCharacters, id))
+		}
+
+		return p
+	case errors.Is(err, store.ErrInvalidReplacement):
+		return problem.Validation([]validation.FieldError{{
+			Field:   "replacement",
+			Message: fmt.Sprintf("must be another %s that exists", resource),
+		}})
+	default:
+		return storeError(err, notFound)
+	}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+	"github.com/njwong/me-api/validation"
+)
+
+// Fields revisions can be sorted by, e.g. -revision for the newest first
+var revisionSortFields = []string{"revision"}
+
+// handleGetRevisions lists the revisions of a record of resource, where
+// notFound describes the record when it has none. Revisions of deleted
+// records are only served on the admin route, when admin is set.
+func handleGetRevisions(s *store.Store, resource string, notFound string, admin bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
+
+		if err != nil {
+			return err
+		}
+
+		opts, err := parseListOptions(c, revisionSortFields)
+
+		if err != nil {
+			return err
+		}
+
+		if !admin {
+			deleted, err := recordDeleted(c, s, resource, id, notFound)
+
+			if err != nil {
+				return err
+			}
+
+			// Hand requests for deleted records on to the admin route, which
+			// requires a token
+			if deleted {
+				return c.Next()
+			}
+		}
+
+		revisionList, total, err := s.Revisions.List(c.UserContext(), resource, id, pageOptions(opts))
+
+		if err != nil {
+			return storeError(err, notFound)
+		}
+
+		if total == 0 {
+			return problem.NotFound(notFound)
+		}
+
+		for i := range revisionList {
+			revisionList[i].URL = revisionURL(c, revisionList[i])
+		}
+
+		response := newPage(c, opts, revisionList, total, func(revision models.Revision) int { return revision.Revision })
+
+		return sendPage(c, response, nil)
+	}
+}
+
+// handleGetRevision gets a revision of a record of resource. Like
+// handleGetRevisions, it leaves deleted records to the admin route.
+func handleGetRevision(s *store.Store, resource string, admin bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
+
+		if err != nil {
+			return err
+		}
+
+		number, err := parseRevision(c)
+
+		if err != nil {
+			return err
+		}
+
+		if !admin {
+			deleted, err := recordDeleted(c, s, resource, id, "Revision not found")
+
+			if err != nil {
+				return err
+			}
+
+			if deleted {
+				return c.Next()
+			}
+		}
+
+		revision, err := s.Revisions.Get(c.UserContext(), resource, id, number)
+
+		if err != nil {
+			return storeError(err, "Revision not found")
+		}
+
+		revision.URL = revisionURL(c, *revision)
+
+		return c.JSON(revision)
+	}
+}
+
+// recordDeleted reports whether a record of resource has been deleted. It
+// returns a not found problem, described by notFound, for a record that
+// never existed. Records are only ever soft deleted, so one that can't be
+// read but has revisions has been deleted.
+func recordDeleted(c *fiber.Ctx, s *store.Store, resource string, id int, notFound string) (bool, error) {
+	exists, err := recordExists(c, s, resource, id)
+
+	if err != nil || exists {
+		return false, err
+	}
+
+	_, total, err := s.Revisions.List(c.UserContext(), resource, id, store.ListOptions{Limit: 1})
+
+	if err != nil {
+		return false, storeError(err, notFound)
+	}
+
+	if total == 0 {
+		return false, problem.NotFound(notFound)
+	}
+
+	return true, nil
+}
+
+// recordExists reports whether a record of resource exists and hasn't been
+// deleted
+func recordExists(c *fiber.Ctx, s *store.Store, resource string, id int) (bool, error) {
+	var err error
+
+	switch resource {
+	case store.ResourceCharacters:
+		_, err = s.Characters.Get(c.UserContext(), id)
+	case store.ResourceGenders:
+		_, err = s.Genders.Get(c.UserContext(), id)
+	case store.ResourceSpecies:
+		_, err = s.Species.Get(c.UserContext(), id)
+	}
+
+	if errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, storeError(err, "")
+	}
+
+	return true, nil
+}
+
+// parseRevision reads the revision number from the route
+func parseRevision(c *fiber.Ctx) (int, error) {
+	number, err := strconv.Atoi(c.Params("rev"))
+
+	if err != nil || number < 1 {
+		return 0, problem.BadRequest("Invalid revision")
+	}
+
+	return number, nil
+}
+
+func revisionURL(c *fiber.Ctx, revision models.Revision) string {
+	return fmt.Sprintf("%s/revisions/%d", resourceURL(c, revision.Resource, revision.ResourceID), revision.Revision)
+}
+
+// parseRevisionRecord reads the record saved in the revision named by the
+// route into out, validating it like the body of an update. Revisions that
+// deleted the record can't be reverted to.
+func parseRevisionRecord(c *fiber.Ctx, revisions store.RevisionStore, resource string, id int, out any) error {
+	number, err := parseRevision(c)
+
+	if err != nil {
+		return err
+	}
+
+	revision, err := revisions.Get(c.UserContext(), resource, id, number)
+
+	if err != nil {
+		return storeError(err, "Revision not found")
+	}
+
+	if revision.Deleted {
+		return problem.Conflict(fmt.Sprintf("Revision %d deleted the record, delete it instead of reverting", number))
+	}
+
+	if err := json.Unmarshal(revision.Record, out); err != nil {
+		return problem.Internal(err)
+	}
+
+	if fieldErrors := validation.Struct(out); len(fieldErrors) > 0 {
+		return problem.Validation(fieldErrors)
+	}
+
+	return nil
+}
+
+// restoreForRevert restores a record before reverting it, so that reverting
+// a deleted record brings it back. Records that aren't deleted are left as
+// they are.
+func restoreForRevert(c *fiber.Ctx, restore func(ctx context.Context, id int) error, id int) error {
+	err := restore(c.UserContext(), id)
+
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return storeError(err, "")
+	}
+
+	return nil
+}
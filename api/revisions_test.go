@@ -0,0 +1,48 @@
+package api_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// TestRevisionsOfMissingRecords checks that the public routes only hand
+// deleted records on to the admin routes, and that records that never
+// existed aren't found
+func TestRevisionsOfMissingRecords(t *testing.T) {
+	ctx := context.Background()
+	s := store.WithHistory(store.NewMemory())
+
+	live := models.Species{Name: "Asari"}
+	deleted := models.Species{Name: "Prothean"}
+
+	mustDo(t, s.Species.Create(ctx, &live))
+	mustDo(t, s.Species.Create(ctx, &deleted))
+	mustDo(t, s.Species.Delete(ctx, deleted.ID, store.DeleteOptions{Policy: store.Restrict}))
+
+	app := newApp(s)
+
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{"/api/species/1/revisions", fiber.StatusOK},
+		{"/api/species/1/revisions/1", fiber.StatusOK},
+		{"/api/species/1/revisions/9", fiber.StatusNotFound},
+		{"/api/species/2/revisions", fiber.StatusUnauthorized},
+		{"/api/species/2/revisions/1", fiber.StatusUnauthorized},
+		{"/api/species/99/revisions", fiber.StatusNotFound},
+		{"/api/species/99/revisions/1", fiber.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		resp, body := request(t, app, fiber.MethodGet, test.url, "")
+
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s gave %d, want %d: %s", test.url, resp.StatusCode, test.status, body)
+		}
+	}
+}
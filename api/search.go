@@ -0,0 +1,81 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/search"
+	"github.com/njwong/me-api/store"
+)
+
+const defaultSearchLimit = 10
+
+type searchResult struct {
+	Type  string  `json:"type"`
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	URL   string  `json:"url"`
+	Score float64 `json:"score"`
+}
+
+// searchTypes maps store resource names to the result types shown to clients
+var searchTypes = map[string]string{
+	store.ResourceCharacters: "character",
+	store.ResourceGenders:    "gender",
+	store.ResourceSpecies:    "species",
+}
+
+func AddSearchRoutes(app *fiber.App, index *search.Index) {
+	apiGroup := app.Group("/api")
+	apiGroup.Get("/search", handleSearch(index))
+}
+
+func handleSearch(index *search.Index) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query := c.Query("q")
+
+		if query == "" {
+			return problem.BadRequest("Missing q")
+		}
+
+		limit := defaultSearchLimit
+
+		if raw := c.Query("limit"); raw != "" {
+			value, err := strconv.Atoi(raw)
+
+			if err != nil || value < 1 {
+				return problem.BadRequest("Invalid limit")
+			}
+
+			limit = value
+
+			if limit > maxPageLimit {
+				limit = maxPageLimit
+			}
+		}
+
+		matches, err := index.Search(c.UserContext(), query, limit)
+
+		if err != nil {
+			return storeError(err, "")
+		}
+
+		results := []searchResult{}
+
+		for _, match := range matches {
+			results = append(results, searchResult{
+				Type:  searchTypes[match.Resource],
+				ID:    match.ID,
+				Name:  match.Name,
+				URL:   resourceURL(c, match.Resource, match.ID),
+				Score: match.Score,
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"count":   len(results),
+			"results": results,
+		})
+	}
+}
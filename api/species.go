@@ -1,229 +1,343 @@
 package api
 
 import (
-	"fmt"
-
 	"github.com/gofiber/fiber/v2"
-	"github.com/njwong/me-api/database"
 	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
 )
 
-func AddSpeciesEndpoints(app *fiber.App) {
+func AddSpeciesEndpoints(app *fiber.App, s *store.Store) {
 	apiGroup := app.Group("/api")
-	apiGroup.Get("/species", handleGetSpecies)
-	apiGroup.Get("/species/:id", handleGetSpeciesById)
+	apiGroup.Get("/species", handleGetSpecies(s.Species, s.Audit, false))
+	apiGroup.Get("/species/:id", handleGetSpeciesById(s.Species, s.Audit))
+	apiGroup.Get("/species/:id/revisions", handleGetRevisions(s, store.ResourceSpecies, "Species not found", false))
+	apiGroup.Get("/species/:id/revisions/:rev", handleGetRevision(s, store.ResourceSpecies, false))
 }
 
-func AddAdminSpeciesEndpoints(app *fiber.App) {
+func AddAdminSpeciesEndpoints(app *fiber.App, s *store.Store) {
 	apiGroup := app.Group("/api")
-	apiGroup.Post("/species", handleCreateSpecies)
-	apiGroup.Put("/species/:id", handleUpdateSpecies)
-	apiGroup.Delete("/species/:id", handleDeleteSpeciesById)
+	apiGroup.Get("/species", handleGetSpecies(s.Species, s.Audit, true))
+	apiGroup.Get("/species/:id/revisions", handleGetRevisions(s, store.ResourceSpecies, "Species not found", true))
+	apiGroup.Get("/species/:id/revisions/:rev", handleGetRevision(s, store.ResourceSpecies, true))
+	apiGroup.Post("/species", handleCreateSpecies(s))
+	apiGroup.Put("/species/:id", handleUpdateSpecies(s))
+	apiGroup.Patch("/species/:id", handlePatchSpecies(s))
+	apiGroup.Delete("/species/:id", handleDeleteSpeciesById(s))
+	apiGroup.Post("/species/:id/restore", handleRestoreSpecies(s))
+	apiGroup.Post("/species/:id/revert/:rev", handleRevertSpecies(s))
 }
 
-func handleGetSpecies(c *fiber.Ctx) error {
-	db := database.Client
+// handleGetSpecies lists species. Deleted ones are only included on the
+// admin route, when admin is set.
+func handleGetSpecies(speciesStore store.SpeciesStore, audit store.AuditStore, admin bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		opts, err := parseListOptions(c, speciesSortFields)
 
-	query := "SELECT * FROM species"
+		if err != nil {
+			return err
+		}
 
-	res, err := db.Query(query)
+		// Hand requests for deleted records on to the admin route, which
+		// requires a token
+		if opts.IncludeDeleted && !admin {
+			return c.Next()
+		}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		fields, err := parseFields(c, speciesFields)
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Internal server error",
-		})
-	}
+		if err != nil {
+			return err
+		}
 
-	defer res.Close()
+		speciesList, total, err := speciesStore.List(c.UserContext(), pageOptions(opts))
 
-	speciesList := []models.Species{}
+		if err != nil {
+			return storeError(err, "Species not found")
+		}
 
-	for res.Next() {
-		var species models.Species
+		for i := range speciesList {
+			speciesList[i].URL = resourceURL(c, store.ResourceSpecies, speciesList[i].ID)
+		}
+
+		if err := setLastModified(c, audit, changed{resource: store.ResourceSpecies}); err != nil {
+			return err
+		}
+
+		response := newPage(c, opts, speciesList, total, func(species models.Species) int { return species.ID })
+
+		return sendPage(c, response, fields)
+	}
+}
+
+func handleGetSpeciesById(speciesStore store.SpeciesStore, audit store.AuditStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
+
+		if err != nil {
+			return err
+		}
 
-		err := res.Scan(&species.ID, &species.Name)
+		species, err := getSpecies(c, speciesStore, id)
 
 		if err != nil {
-			fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			return err
+		}
 
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-				"msg": "Internal server error",
-			})
+		if err := setLastModified(c, audit, changed{resource: store.ResourceSpecies, id: species.ID}); err != nil {
+			return err
 		}
 
-		speciesList = append(speciesList, species)
+		return sendSpecies(c, species)
 	}
-
-	return c.JSON(speciesList)
 }
 
-func handleGetSpeciesById(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+func handleCreateSpecies(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var species models.Species
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err := parseBody(c, &species); err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
+		var stored *models.Species
+
+		err := transaction(c, s, func(tx *store.Store) error {
+			if err := tx.Species.Create(c.UserContext(), &species); err != nil {
+				return storeError(err, "Species not found")
+			}
+
+			var err error
+			stored, err = getSpecies(c, tx.Species, species.ID)
+			return err
 		})
-	}
 
-	species, err := findSpeciesByID(id)
+		if err != nil {
+			return err
+		}
 
-	if species == nil || err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		c.Location(resourceURL(c, store.ResourceSpecies, species.ID))
+		c.Status(fiber.StatusCreated)
 
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Species not found",
-		})
+		return sendSpecies(c, stored)
 	}
-
-	return c.JSON(species)
 }
 
-func findSpeciesByID(id int) (*models.Species, error) {
-	db := database.Client
+func handleUpdateSpecies(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	var species models.Species
+		if err != nil {
+			return err
+		}
 
-	query := fmt.Sprintf("SELECT * FROM species WHERE id = %d", id)
-	err := db.QueryRow(query).Scan(&species.ID, &species.Name)
+		var stored *models.Species
 
-	return &species, err
-}
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := checkSpeciesVersion(c, tx.Species, id); err != nil {
+				return err
+			}
 
-func handleCreateSpecies(c *fiber.Ctx) error {
-	var species models.Species
+			var species models.Species
 
-	err := c.BodyParser(&species)
+			if err := parseBody(c, &species); err != nil {
+				return err
+			}
 
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
+			if err := tx.Species.Update(c.UserContext(), id, &species); err != nil {
+				return storeError(err, "Species not found")
+			}
+
+			stored, err = getSpecies(c, tx.Species, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendSpecies(c, stored)
 	}
+}
 
-	db := database.Client
+func handleDeleteSpeciesById(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	query := fmt.Sprintf("INSERT INTO species (name) VALUES (\"%s\")", species.Name)
+		if err != nil {
+			return err
+		}
 
-	result, err := db.Exec(query)
+		opts, err := parseDeleteOptions(c)
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to create species",
-		})
-	}
+		if err != nil {
+			return err
+		}
 
-	id, err := result.LastInsertId()
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := checkSpeciesVersion(c, tx.Species, id); err != nil {
+				return err
+			}
 
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to get species ID",
+			if err := tx.Species.Delete(c.UserContext(), id, opts); err != nil {
+				return deleteError(c, err, "species", "Species not found")
+			}
+
+			return nil
 		})
-	}
 
-	species.ID = int(id)
-	return c.Status(fiber.StatusCreated).JSON(species)
+		if err != nil {
+			return err
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Species deleted"})
+	}
 }
 
-func handleUpdateSpecies(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+func handlePatchSpecies(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
-		})
-	}
+		var stored *models.Species
 
-	var species models.Species
-	err = c.BodyParser(&species)
+		err = transaction(c, s, func(tx *store.Store) error {
+			species, err := getSpecies(c, tx.Species, id)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			if err != nil {
+				return err
+			}
 
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid data",
-		})
-	}
+			if err := checkIfMatch(c, speciesETag(species)); err != nil {
+				return err
+			}
 
-	db := database.Client
+			species.URL = resourceURL(c, store.ResourceSpecies, species.ID)
 
-	query := fmt.Sprintf("UPDATE species SET name = '%s' WHERE id = %d", species.Name, id)
+			if err := parsePatch(c, species); err != nil {
+				return err
+			}
 
-	result, err := db.Exec(query)
+			if err := tx.Species.Update(c.UserContext(), id, species); err != nil {
+				return storeError(err, "Species not found")
+			}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
-
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to update species",
+			stored, err = getSpecies(c, tx.Species, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendSpecies(c, stored)
 	}
+}
 
-	rowsAffected, err := result.RowsAffected()
+// getSpecies reads a species, reporting a missing one as not found
+func getSpecies(c *fiber.Ctx, speciesStore store.SpeciesStore, id int) (*models.Species, error) {
+	species, err := speciesStore.Get(c.UserContext(), id)
 
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to update species",
-		})
+		return nil, storeError(err, "Species not found")
 	}
 
-	if rowsAffected == 0 {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Species not found",
-		})
-	}
+	return species, nil
+}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Species updated"})
+// sendSpecies responds with a species read from the store, so that writes
+// return the species in the same form as a GET for it
+func sendSpecies(c *fiber.Ctx, species *models.Species) error {
+	species.URL = resourceURL(c, store.ResourceSpecies, species.ID)
+	c.Set(fiber.HeaderETag, speciesETag(species))
+
+	return c.JSON(species)
 }
 
-func handleDeleteSpeciesById(c *fiber.Ctx) error {
-	id, err := c.ParamsInt("id")
+// checkSpeciesVersion checks the If-Match header of a request against the
+// stored species
+func checkSpeciesVersion(c *fiber.Ctx, speciesStore store.SpeciesStore, id int) error {
+	if !hasIfMatch(c) {
+		return nil
+	}
+
+	current, err := getSpecies(c, speciesStore, id)
 
 	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
-
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"msg": "Bad request - invalid id",
-		})
+		return err
 	}
 
-	db := database.Client
+	return checkIfMatch(c, speciesETag(current))
+}
 
-	query := fmt.Sprintf("DELETE FROM species WHERE id = %d", id)
+func handleRestoreSpecies(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	result, err := db.Exec(query)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		var stored *models.Species
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to delete species",
+		err = transaction(c, s, func(tx *store.Store) error {
+			if err := tx.Species.Restore(c.UserContext(), id); err != nil {
+				return storeError(err, "Deleted species not found")
+			}
+
+			stored, err = getSpecies(c, tx.Species, id)
+			return err
 		})
+
+		if err != nil {
+			return err
+		}
+
+		return sendSpecies(c, stored)
 	}
+}
 
-	rowsAffected, err := result.RowsAffected()
+// handleRevertSpecies updates a species to the state saved in one of its
+// revisions, restoring it first if it has been deleted
+func handleRevertSpecies(s *store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := parseID(c)
 
-	if err != nil {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+		if err != nil {
+			return err
+		}
 
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"msg": "Failed to delete species",
-		})
-	}
+		var stored *models.Species
+
+		err = transaction(c, s, func(tx *store.Store) error {
+			var species models.Species
+
+			if err := parseRevisionRecord(c, tx.Revisions, store.ResourceSpecies, id, &species); err != nil {
+				return err
+			}
+
+			if err := checkSpeciesVersion(c, tx.Species, id); err != nil {
+				return err
+			}
 
-	if rowsAffected == 0 {
-		fmt.Printf("Error - \"%s\" for the following request:\n", err.Error())
+			if err := restoreForRevert(c, tx.Species.Restore, id); err != nil {
+				return err
+			}
 
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"msg": "Species not found",
+			if err := tx.Species.Update(c.UserContext(), id, &species); err != nil {
+				return storeError(err, "Species not found")
+			}
+
+			stored, err = getSpecies(c, tx.Species, id)
+			return err
 		})
-	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"msg": "Species deleted"})
+		if err != nil {
+			return err
+		}
+
+		return sendSpecies(c, stored)
+	}
 }
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+// transaction runs a write and the reads that check it with the stores bound
+// to a single transaction. The reads bypass the cache, and records read with
+// Get stay locked until the write is committed, so an If-Match check can't
+// pass for two writers at once. Errors that aren't already problems are
+// reported like other store errors.
+func transaction(c *fiber.Ctx, s *store.Store, fn func(tx *store.Store) error) error {
+	err := s.Transaction(c.UserContext(), fn)
+
+	var p *problem.Problem
+
+	if err == nil || errors.As(err, &p) {
+		return err
+	}
+
+	return storeError(err, "")
+}
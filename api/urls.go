@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/middleware"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// baseURL returns the base URL for links, as set by middleware.BaseURL
+func baseURL(c *fiber.Ctx) string {
+	if base, ok := c.Locals(middleware.BaseURLKey).(string); ok {
+		return base
+	}
+
+	return c.BaseURL()
+}
+
+// resourceURL returns the canonical URL of a record, where resource is one of
+// the store resource names such as store.ResourceCharacters
+func resourceURL(c *fiber.Ctx, resource string, id int) string {
+	return fmt.Sprintf("%s/api/%s/%d", baseURL(c), resource, id)
+}
+
+// linkCharacter fills in the URLs of a character and its species and gender,
+// and collapses the relations that aren't in expand to just their URLs
+func linkCharacter(c *fiber.Ctx, character *models.CharacterObject, expand map[string]bool) {
+	character.URL = resourceURL(c, store.ResourceCharacters, character.ID)
+
+	if character.Species != nil {
+		character.Species.URL = resourceURL(c, store.ResourceSpecies, character.Species.ID)
+		character.Species.LinkOnly = !expand["species"]
+	}
+
+	if character.Gender != nil {
+		character.Gender.URL = resourceURL(c, store.ResourceGenders, character.Gender.ID)
+		character.Gender.LinkOnly = !expand["gender"]
+	}
+}
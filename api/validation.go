@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+	"github.com/njwong/me-api/validation"
+)
+
+// parseBody decodes the request body into out and validates it. A body that
+// can't be parsed is a bad request, while unknown, mistyped and invalid fields
+// are reported together as a validation problem.
+func parseBody(c *fiber.Ctx, out any) error {
+	fieldErrors, err := decodeBody(c, out)
+
+	if err != nil {
+		return problem.BadRequest("Invalid request body")
+	}
+
+	if len(fieldErrors) > 0 {
+		return problem.Validation(fieldErrors)
+	}
+
+	return nil
+}
+
+// decodeBody decodes the request body into out. Unknown and mistyped fields
+// in JSON bodies are reported as field errors along with the validation
+// errors, any other error means the body couldn't be parsed.
+func decodeBody(c *fiber.Ctx, out any) ([]validation.FieldError, error) {
+	if !c.Is("json") {
+		if err := c.BodyParser(out); err != nil {
+			return nil, err
+		}
+
+		return validation.Struct(out), nil
+	}
+
+	return decodeJSON(c.Body(), out)
+}
+
+// decodeJSON decodes and validates a JSON object like decodeBody
+func decodeJSON(data []byte, out any) ([]validation.FieldError, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(out)
+
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case err == nil:
+		return validation.Struct(out), nil
+	case errors.As(err, &typeError) && typeError.Field != "":
+		return []validation.FieldError{{
+			Field:   typeError.Field,
+			Message: "must be a " + jsonType(typeError.Type.Kind().String()),
+		}}, nil
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), "\"")
+
+		return []validation.FieldError{{Field: field, Message: "is not a known field"}}, nil
+	default:
+		return nil, err
+	}
+}
+
+// jsonType describes a Go kind using JSON type names
+func jsonType(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	default:
+		return kind
+	}
+}
+
+// parseCharacter parses and validates a character from the request body,
+// including checking that its species and gender exist
+func parseCharacter(c *fiber.Ctx, s *store.Store, character *models.Character) error {
+	if err := parseBody(c, character); err != nil {
+		return err
+	}
+
+	return checkCharacterReferences(c, s, character)
+}
+
+// checkCharacterReferences returns a validation problem if the species or
+// gender of a character don't exist
+func checkCharacterReferences(c *fiber.Ctx, s *store.Store, character *models.Character) error {
+	fieldErrors, err := characterReferenceErrors(c.UserContext(), s, character)
+
+	if err != nil {
+		return storeError(err, "")
+	}
+
+	if len(fieldErrors) > 0 {
+		return problem.Validation(fieldErrors)
+	}
+
+	return nil
+}
+
+// characterReferenceErrors checks that the species and gender of a character exist
+func characterReferenceErrors(ctx context.Context, s *store.Store, character *models.Character) ([]validation.FieldError, error) {
+	fieldErrors := []validation.FieldError{}
+
+	if character.Species > 0 {
+		_, err := s.Species.Get(ctx, character.Species)
+
+		if errors.Is(err, store.ErrNotFound) {
+			fieldErrors = append(fieldErrors, validation.FieldError{
+				Field:   "species",
+				Message: fmt.Sprintf("species %d does not exist", character.Species),
+			})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	if character.Gender > 0 {
+		_, err := s.Genders.Get(ctx, character.Gender)
+
+		if errors.Is(err, store.ErrNotFound) {
+			fieldErrors = append(fieldErrors, validation.FieldError{
+				Field:   "gender",
+				Message: fmt.Sprintf("gender %d does not exist", character.Gender),
+			})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return fieldErrors, nil
+}
+
+// parseID reads the id route parameter
+func parseID(c *fiber.Ctx) (int, error) {
+	id, err := c.ParamsInt("id")
+
+	if err != nil {
+		return 0, problem.BadRequest("Invalid id")
+	}
+
+	return id, nil
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/validation"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []validation.FieldError
+	}{
+		{"valid", `{"name":"Garrus","species":1,"gender":0,"class":"Sniper"}`, []validation.FieldError{}},
+		{"unknown field", `{"name":"Garrus","rank":"Archangel"}`, []validation.FieldError{{Field: "rank", Message: "is not a known field"}}},
+		{"mistyped field", `{"name":"Garrus","species":"Turian"}`, []validation.FieldError{{Field: "species", Message: "must be a number"}}},
+		{"invalid field", `{"name":" ","species":1}`, []validation.FieldError{{Field: "name", Message: "is required"}}},
+		{"negative reference", `{"name":"Garrus","gender":-1}`, []validation.FieldError{{Field: "gender", Message: "must be at least 0"}}},
+	}
+
+	for _, test := range tests {
+		var character models.Character
+
+		got, err := decodeJSON([]byte(test.body), &character)
+
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeJSONInvalid(t *testing.T) {
+	for _, body := range []string{``, `{"name":`, `[]`, `"Garrus"`} {
+		var character models.Character
+
+		if _, err := decodeJSON([]byte(body), &character); err == nil {
+			t.Errorf("%q didn't fail", body)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/njwong/me-api/database"
+	"github.com/njwong/me-api/exporter"
+	"github.com/njwong/me-api/importer"
+	"github.com/njwong/me-api/seed"
+	"github.com/njwong/me-api/store"
+)
+
+// runCommand runs a maintenance command instead of starting the server
+func runCommand(name string, args []string) {
+	switch name {
+	case "migrate":
+		runMigrate(args)
+	case "seed":
+		runSeed()
+	case "import":
+		runImport(args)
+	case "export":
+		runExport(args)
+	default:
+		log.Fatalf("(main) unknown command %q", name)
+	}
+}
+
+// openDatabase connects to the SQL database described by the DSN environment variable
+func openDatabase() (*sql.DB, database.Dialect) {
+	db, dialect, err := database.Open(os.Getenv("DSN"))
+
+	if err != nil {
+		log.Fatal("(main) failed to open db connection - ", err)
+	}
+
+	return db, dialect
+}
+
+// runMigrate handles "migrate up", "migrate down [steps]" and "migrate status"
+func runMigrate(args []string) {
+	db, dialect := openDatabase()
+	defer db.Close()
+
+	action := "up"
+
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "up":
+		versions, err := database.MigrateUp(db, dialect)
+
+		if err != nil {
+			log.Fatal("(migrate) ", err)
+		}
+
+		fmt.Printf("Applied %d migration(s) %v\n", len(versions), versions)
+	case "down":
+		steps := 1
+
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+
+			if err != nil || n < 1 {
+				log.Fatalf("(migrate) invalid number of steps %q", args[1])
+			}
+
+			steps = n
+		}
+
+		versions, err := database.MigrateDown(db, dialect, steps)
+
+		if err != nil {
+			log.Fatal("(migrate) ", err)
+		}
+
+		fmt.Printf("Reverted %d migration(s) %v\n", len(versions), versions)
+	case "status":
+		migrations, err := database.Migrations(dialect)
+
+		if err != nil {
+			log.Fatal("(migrate) ", err)
+		}
+
+		applied, err := database.AppliedVersions(db)
+
+		if err != nil {
+			log.Fatal("(migrate) ", err)
+		}
+
+		for _, migration := range migrations {
+			status := "pending"
+
+			if applied[migration.Version] {
+				status = "applied"
+			}
+
+			fmt.Printf("%04d_%s\t%s\n", migration.Version, migration.Name, status)
+		}
+	default:
+		log.Fatalf("(migrate) unknown action %q, expected up, down or status", action)
+	}
+}
+
+// runSeed loads the embedded reference dataset into the configured store
+func runSeed() {
+	stores := database.Setup()
+
+	dataset, err := seed.Load()
+
+	if err != nil {
+		log.Fatal("(seed) ", err)
+	}
+
+	// Attribute the changes to the seed command in the audit log
+	ctx := store.WithActor(context.Background(), store.Actor{Subject: "seed"})
+
+	result, err := seed.Run(ctx, stores, dataset)
+
+	if err != nil {
+		log.Fatal("(seed) ", err)
+	}
+
+	fmt.Printf("Seeded dataset v%d - %d created, %d updated, %d unchanged\n", dataset.Version, result.Created, result.Updated, result.Unchanged)
+}
+
+// runImport handles "import [-dry-run] [-format csv|json|ndjson] <resource> <file>",
+// where the format defaults to the one given by the file's extension
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "report the changes without writing them")
+	formatName := flags.String("format", "", "csv, json or ndjson")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		log.Fatal("(import) usage: import [-dry-run] [-format csv|json|ndjson] <resource> <file>")
+	}
+
+	resource, path := flags.Arg(0), flags.Arg(1)
+	format := importer.Format(*formatName)
+
+	if format == "" {
+		var ok bool
+		format, ok = importer.FormatForFile(path)
+
+		if !ok {
+			log.Fatalf("(import) can't tell the format of %q, set it with -format", path)
+		}
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		log.Fatal("(import) ", err)
+	}
+
+	defer file.Close()
+
+	rows, err := importer.Parse(file, format)
+
+	if err != nil {
+		log.Fatalf("(import) invalid import - %s", err)
+	}
+
+	stores := database.Setup()
+
+	// Attribute the changes to the import command in the audit log
+	ctx := store.WithActor(context.Background(), store.Actor{Subject: "import"})
+
+	report, err := importer.Run(ctx, stores, resource, rows, *dryRun)
+
+	if errors.Is(err, importer.ErrInvalidRows) {
+		for _, fieldError := range report.Errors {
+			fmt.Printf("%s %s\n", fieldError.Field, fieldError.Message)
+		}
+
+		log.Fatalf("(import) %d error(s), nothing was imported", len(report.Errors))
+	}
+
+	if err != nil {
+		log.Fatal("(import) ", err)
+	}
+
+	summary := "Imported"
+
+	if report.DryRun {
+		summary = "Dry run, nothing was written"
+	}
+
+	fmt.Printf("%s - %d created, %d updated, %d unchanged\n", summary, report.Created, report.Updated, report.Unchanged)
+}
+
+// runExport handles "export [-format json|ndjson|csv|sql] [-include-deleted=false] [-o file]",
+// writing to stdout unless a file is given. Deleted records are included
+// unless turned off, so the export can restore the database as a whole.
+func runExport(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", string(exporter.JSON), "json, ndjson, csv or sql")
+	includeDeleted := flags.Bool("include-deleted", true, "include deleted records")
+	path := flags.String("o", "", "file to write the export to")
+	flags.Parse(args)
+
+	out := os.Stdout
+
+	if *path != "" {
+		file, err := os.Create(*path)
+
+		if err != nil {
+			log.Fatal("(export) ", err)
+		}
+
+		defer file.Close()
+		out = file
+	}
+
+	stores := database.Setup()
+	w := bufio.NewWriter(out)
+
+	if err := exporter.Write(context.Background(), w, stores, exporter.Format(*format), time.Now().UTC(), *includeDeleted); err != nil {
+		log.Fatal("(export) ", err)
+	}
+}
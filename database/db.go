@@ -4,18 +4,105 @@ import (
 	"database/sql"
 	"log"
 	"os"
+	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	_ "modernc.org/sqlite"
+
+	"github.com/njwong/me-api/store"
 )
 
-var Client *sql.DB
+// Dialect identifies the SQL database behind a connection
+type Dialect string
+
+const (
+	MySQL  Dialect = "mysql"
+	SQLite Dialect = "sqlite"
+)
+
+// Setup creates the store described by the DSN environment variable,
+// applying any pending migrations first. Every change made through it is
+// recorded in the audit log and revision history.
+func Setup() *store.Store {
+	dsn := os.Getenv("DSN")
+
+	if dsn == "memory://" {
+		return store.WithHistory(store.NewMemory())
+	}
 
-func Setup() {
-	db, err := sql.Open("mysql", os.Getenv("DSN"))
+	db, dialect, err := Open(dsn)
 
 	if err != nil {
 		log.Fatal("Failed to open db connection", err)
 	}
 
-	Client = db
+	// Bring the schema up to date before serving any requests
+	versions, err := MigrateUp(db, dialect)
+
+	if err != nil {
+		log.Fatal("Failed to migrate db - ", err)
+	}
+
+	if len(versions) > 0 {
+		log.Printf("Applied migrations %v", versions)
+	}
+
+	return store.WithHistory(store.NewSQL(db))
+}
+
+// Open connects to the database described by dsn. DSNs starting with
+// "sqlite://" or "file:" open an embedded SQLite database, anything else is
+// treated as a MySQL connection string.
+func Open(dsn string) (*sql.DB, Dialect, error) {
+	if path, ok := sqlitePath(dsn); ok {
+		db, err := openSQLite(path)
+		return db, SQLite, err
+	}
+
+	db, err := openMySQL(dsn)
+	return db, MySQL, err
+}
+
+// sqlitePath returns the SQLite file path for the given DSN
+func sqlitePath(dsn string) (string, bool) {
+	if strings.HasPrefix(dsn, "sqlite://") {
+		return strings.TrimPrefix(dsn, "sqlite://"), true
+	}
+
+	if strings.HasPrefix(dsn, "file:") {
+		return dsn, true
+	}
+
+	return "", false
+}
+
+func openMySQL(dsn string) (*sql.DB, error) {
+	config, err := mysql.ParseDSN(dsn)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Report the rows matched by an UPDATE rather than the rows changed, so
+	// that saving a record without changes isn't mistaken for a missing one
+	config.ClientFoundRows = true
+
+	// Scan DATETIME columns into time.Time
+	config.ParseTime = true
+
+	return sql.Open("mysql", config.FormatDSN())
+}
+
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer, and each connection to ":memory:"
+	// would otherwise get its own empty database
+	db.SetMaxOpenConns(1)
+
+	return db, nil
 }
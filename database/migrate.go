@@ -0,0 +1,234 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a numbered schema change with SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER NOT NULL PRIMARY KEY,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migrations returns the migrations for the given dialect ordered by version.
+// Files are named like "0001_create_tables.up.sql" and
+// "0001_create_tables.down.sql".
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+
+	entries, err := fs.ReadDir(migrationFiles, dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		base, direction, ok := cutMigrationSuffix(name)
+
+		if !ok {
+			return nil, fmt.Errorf("unexpected migration file %q", name)
+		}
+
+		number, label, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q", name)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+
+		if !ok {
+			migration = &Migration{Version: version, Name: label}
+			byVersion[version] = migration
+		}
+
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// cutMigrationSuffix splits a migration file name into its base name and direction
+func cutMigrationSuffix(name string) (string, string, bool) {
+	if base, ok := strings.CutSuffix(name, ".up.sql"); ok {
+		return base, "up", true
+	}
+
+	if base, ok := strings.CutSuffix(name, ".down.sql"); ok {
+		return base, "down", true
+	}
+
+	return "", "", false
+}
+
+// AppliedVersions returns the versions recorded in the schema_migrations table
+func AppliedVersions(db *sql.DB) (map[int]bool, error) {
+	if _, err := db.Exec(createMigrationsTable); err != nil {
+		return nil, err
+	}
+
+	res, err := db.Query("SELECT version FROM schema_migrations")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	applied := map[int]bool{}
+
+	for res.Next() {
+		var version int
+
+		if err := res.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	return applied, res.Err()
+}
+
+// MigrateUp applies every pending migration in order and returns the
+// versions that were applied
+func MigrateUp(db *sql.DB, dialect Dialect) ([]int, error) {
+	migrations, err := Migrations(dialect)
+
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := AppliedVersions(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []int{}
+
+	for _, migration := range migrations {
+		if applied[migration.Version] {
+			continue
+		}
+
+		err := runMigration(db, migration.Up, "INSERT INTO schema_migrations (version) VALUES (?)", migration.Version)
+
+		if err != nil {
+			return versions, fmt.Errorf("migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		versions = append(versions, migration.Version)
+	}
+
+	return versions, nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+// and returns the versions that were reverted
+func MigrateDown(db *sql.DB, dialect Dialect, steps int) ([]int, error) {
+	migrations, err := Migrations(dialect)
+
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := AppliedVersions(db)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []int{}
+
+	for i := len(migrations) - 1; i >= 0 && len(versions) < steps; i-- {
+		migration := migrations[i]
+
+		if !applied[migration.Version] {
+			continue
+		}
+
+		err := runMigration(db, migration.Down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+
+		if err != nil {
+			return versions, fmt.Errorf("reverting migration %04d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+
+		versions = append(versions, migration.Version)
+	}
+
+	return versions, nil
+}
+
+// runMigration executes each statement of a migration script and then
+// updates schema_migrations, all within a single transaction. Note that
+// MySQL implicitly commits DDL statements, so a failed migration may be
+// partially applied there.
+func runMigration(db *sql.DB, script string, record string, version int) error {
+	tx, err := db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	// Not every driver accepts multiple statements at once, so run them one by one
+	for _, statement := range strings.Split(script, ";") {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(record, version); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,170 @@
+package database_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/njwong/me-api/database"
+)
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openSQLite opens a new, empty SQLite database file
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, dialect, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	mustDo(t, err)
+
+	if dialect != database.SQLite {
+		t.Fatalf("opened a %s database", dialect)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// tables lists the tables in a SQLite database
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	mustDo(t, err)
+
+	defer rows.Close()
+
+	names := []string{}
+
+	for rows.Next() {
+		var name string
+		mustDo(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+
+	mustDo(t, rows.Err())
+
+	return names
+}
+
+func applied(t *testing.T, db *sql.DB) map[int]bool {
+	t.Helper()
+
+	versions, err := database.AppliedVersions(db)
+	mustDo(t, err)
+
+	return versions
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	db := openSQLite(t)
+
+	migrations, err := database.Migrations(database.SQLite)
+	mustDo(t, err)
+
+	all := []int{}
+	reverted := []int{}
+
+	for i, migration := range migrations {
+		all = append(all, migration.Version)
+		reverted = append(reverted, migrations[len(migrations)-1-i].Version)
+
+		if migration.Up == "" || migration.Down == "" {
+			t.Errorf("migration %d is missing a direction", migration.Version)
+		}
+	}
+
+	versions, err := database.MigrateUp(db, database.SQLite)
+	mustDo(t, err)
+
+	if !reflect.DeepEqual(versions, all) {
+		t.Fatalf("migrating up applied %v, want %v", versions, all)
+	}
+
+	migrated := tables(t, db)
+
+	// Data written before reverting doesn't stop the down migrations
+	_, err = db.Exec("INSERT INTO species (name) VALUES ('Asari')")
+	mustDo(t, err)
+
+	versions, err = database.MigrateDown(db, database.SQLite, len(migrations))
+	mustDo(t, err)
+
+	if !reflect.DeepEqual(versions, reverted) {
+		t.Fatalf("migrating down reverted %v, want %v", versions, reverted)
+	}
+
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"schema_migrations"}) || len(applied(t, db)) != 0 {
+		t.Fatalf("migrating down left tables %v and versions %v", got, applied(t, db))
+	}
+
+	versions, err = database.MigrateUp(db, database.SQLite)
+	mustDo(t, err)
+
+	if !reflect.DeepEqual(versions, all) || !reflect.DeepEqual(tables(t, db), migrated) {
+		t.Fatalf("migrating up again applied %v, leaving tables %v", versions, tables(t, db))
+	}
+
+	versions, err = database.MigrateUp(db, database.SQLite)
+	mustDo(t, err)
+
+	if len(versions) != 0 {
+		t.Errorf("migrating up twice applied %v", versions)
+	}
+}
+
+// TestMigrateUpFailure checks that a migration that fails isn't recorded, so
+// it runs again once the problem is fixed
+func TestMigrateUpFailure(t *testing.T) {
+	db := openSQLite(t)
+
+	migrations, err := database.Migrations(database.SQLite)
+	mustDo(t, err)
+
+	last := migrations[len(migrations)-1].Version
+
+	_, err = database.MigrateUp(db, database.SQLite)
+	mustDo(t, err)
+
+	_, err = database.MigrateDown(db, database.SQLite, 1)
+	mustDo(t, err)
+
+	before := tables(t, db)
+
+	// A table left in the way of the last migration makes it fail part way
+	// through, as its CREATE TABLE IF NOT EXISTS keeps the wrong columns
+	_, err = db.Exec("CREATE TABLE revisions (id INTEGER PRIMARY KEY)")
+	mustDo(t, err)
+
+	versions, err := database.MigrateUp(db, database.SQLite)
+
+	if err == nil || len(versions) != 0 {
+		t.Fatalf("migrating up gave versions %v and error %v", versions, err)
+	}
+
+	if applied(t, db)[last] {
+		t.Error("the failed migration was recorded as applied")
+	}
+
+	_, err = db.Exec("DROP TABLE revisions")
+	mustDo(t, err)
+
+	if got := tables(t, db); !reflect.DeepEqual(got, before) {
+		t.Errorf("failed migration left tables %v, want %v", got, before)
+	}
+
+	versions, err = database.MigrateUp(db, database.SQLite)
+	mustDo(t, err)
+
+	if !reflect.DeepEqual(versions, []int{last}) {
+		t.Errorf("migrating up after fixing the failure applied %v", versions)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS characters;
+DROP TABLE IF EXISTS genders;
+DROP TABLE IF EXISTS species;
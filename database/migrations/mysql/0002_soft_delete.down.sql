@@ -0,0 +1,3 @@
+ALTER TABLE characters DROP COLUMN deleted_at;
+ALTER TABLE genders DROP COLUMN deleted_at;
+ALTER TABLE species DROP COLUMN deleted_at;
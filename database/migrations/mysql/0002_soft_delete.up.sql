@@ -0,0 +1,3 @@
+ALTER TABLE species ADD COLUMN deleted_at DATETIME NULL;
+ALTER TABLE genders ADD COLUMN deleted_at DATETIME NULL;
+ALTER TABLE characters ADD COLUMN deleted_at DATETIME NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	created_at DATETIME NOT NULL,
+	actor VARCHAR(255) NOT NULL,
+	request_id VARCHAR(255) NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	resource VARCHAR(32) NOT NULL,
+	resource_id INT NOT NULL,
+	before_state TEXT NULL,
+	after_state TEXT NULL,
+	changes TEXT NULL,
+	INDEX audit_log_resource (resource, resource_id),
+	INDEX audit_log_actor (actor),
+	INDEX audit_log_created_at (created_at)
+);
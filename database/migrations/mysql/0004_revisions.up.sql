@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS revisions (
+	resource VARCHAR(32) NOT NULL,
+	resource_id INT NOT NULL,
+	revision INT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	action VARCHAR(16) NOT NULL,
+	record TEXT NOT NULL,
+	deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (resource, resource_id, revision),
+	INDEX revisions_created_at (created_at)
+);
+
+INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted)
+SELECT 'species', id, 1, UTC_TIMESTAMP(6), IF(deleted_at IS NULL, 'create', 'delete'),
+	JSON_OBJECT('id', id, 'name', name), deleted_at IS NOT NULL
+FROM species;
+
+INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted)
+SELECT 'genders', id, 1, UTC_TIMESTAMP(6), IF(deleted_at IS NULL, 'create', 'delete'),
+	JSON_OBJECT('id', id, 'name', name), deleted_at IS NOT NULL
+FROM genders;
+
+INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted)
+SELECT 'characters', id, 1, UTC_TIMESTAMP(6), IF(deleted_at IS NULL, 'create', 'delete'),
+	JSON_OBJECT('id', id, 'name', name, 'species', COALESCE(species, 0), 'gender', COALESCE(gender, 0), 'class', class),
+	deleted_at IS NOT NULL
+FROM characters;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS species (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS genders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS characters (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	species INTEGER,
+	gender INTEGER,
+	class TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at DATETIME NOT NULL,
+	actor TEXT NOT NULL,
+	request_id TEXT NOT NULL,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	resource_id INTEGER NOT NULL,
+	before_state TEXT,
+	after_state TEXT,
+	changes TEXT
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_resource ON audit_log (resource, resource_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor);
+CREATE INDEX IF NOT EXISTS audit_log_created_at ON audit_log (created_at);
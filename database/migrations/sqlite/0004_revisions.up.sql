@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS revisions (
+	resource TEXT NOT NULL,
+	resource_id INTEGER NOT NULL,
+	revision INTEGER NOT NULL,
+	created_at DATETIME NOT NULL,
+	action TEXT NOT NULL,
+	record TEXT NOT NULL,
+	deleted BOOLEAN NOT NULL DEFAULT FALSE,
+	PRIMARY KEY (resource, resource_id, revision)
+);
+
+CREATE INDEX IF NOT EXISTS revisions_created_at ON revisions (created_at);
+
+INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted)
+SELECT 'species', id, 1, CURRENT_TIMESTAMP, CASE WHEN deleted_at IS NULL THEN 'create' ELSE 'delete' END,
+	json_object('id', id, 'name', name), deleted_at IS NOT NULL
+FROM species;
+
+INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted)
+SELECT 'genders', id, 1, CURRENT_TIMESTAMP, CASE WHEN deleted_at IS NULL THEN 'create' ELSE 'delete' END,
+	json_object('id', id, 'name', name), deleted_at IS NOT NULL
+FROM genders;
+
+INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted)
+SELECT 'characters', id, 1, CURRENT_TIMESTAMP, CASE WHEN deleted_at IS NULL THEN 'create' ELSE 'delete' END,
+	json_object('id', id, 'name', name, 'species', COALESCE(species, 0), 'gender', COALESCE(gender, 0), 'class', class),
+	deleted_at IS NOT NULL
+FROM characters;
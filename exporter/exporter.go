@@ -0,0 +1,253 @@
+// Package exporter writes the whole reference dataset of species, genders
+// and characters as JSON, NDJSON, CSV or SQL.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/njwong/me-api/store"
+)
+
+// SchemaVersion is the version of the export layout, written at the start
+// of every export. It changes whenever records gain, lose or rename fields.
+const SchemaVersion = 1
+
+// Format is the encoding of an export
+type Format string
+
+const (
+	// JSON is an object with the header fields and an array per resource
+	JSON Format = "json"
+
+	// NDJSON has the header on the first line, then one record per line
+	// with its resource
+	NDJSON Format = "ndjson"
+
+	// CSV has the header as a # comment, then one record per row with its
+	// resource, leaving the columns of other resources empty
+	CSV Format = "csv"
+
+	// SQL inserts the records into the tables created by the migrations, in
+	// a single transaction. It loads into MySQL and SQLite alike, as strings
+	// with backslashes or control characters are written as hex literals.
+	SQL Format = "sql"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{JSON, NDJSON, CSV, SQL}
+
+// ContentType returns the media type of an export in format
+func ContentType(format Format) string {
+	switch format {
+	case NDJSON:
+		return "application/x-ndjson"
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case SQL:
+		return "application/sql"
+	default:
+		return "application/json"
+	}
+}
+
+// Resources are exported in this order, so records are always written
+// after the ones they refer to
+var resources = []string{store.ResourceSpecies, store.ResourceGenders, store.ResourceCharacters}
+
+// The fields of each resource, in the order they are written
+var columns = map[string][]string{
+	store.ResourceSpecies:    {"id", "name", "deleted_at"},
+	store.ResourceGenders:    {"id", "name", "deleted_at"},
+	store.ResourceCharacters: {"id", "name", "species", "gender", "class", "deleted_at"},
+}
+
+// Records are read from the store a page at a time
+const pageSize = 500
+
+// header describes an export
+type header struct {
+	SchemaVersion int       `json:"schema_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+}
+
+// encoder writes an export in one format. Records of each resource are
+// written between begin and end, with a value for each of its columns that
+// is an int, a string, a time.Time in UTC or nil.
+type encoder interface {
+	header(h header) error
+	begin(resource string) error
+	record(resource string, values []any) error
+	end(resource string) error
+	footer() error
+}
+
+// flusher is implemented by buffered writers, which are flushed after each
+// page so the export is sent as it is read
+type flusher interface {
+	Flush() error
+}
+
+// Write streams every species, gender and character to w, ordered by
+// resource and then by ID. Deleted records are only included when
+// includeDeleted is set, with the time they were deleted. Each page is read
+// on its own and written once the read is done, so no lock or transaction is
+// held while a slow client downloads the export. It is not a snapshot:
+// records changed while the export is running may appear in either state.
+func Write(ctx context.Context, w io.Writer, s *store.Store, format Format, exportedAt time.Time, includeDeleted bool) error {
+	enc, err := newEncoder(w, format)
+
+	if err != nil {
+		return err
+	}
+
+	if err := enc.header(header{SchemaVersion: SchemaVersion, ExportedAt: exportedAt}); err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		if err := enc.begin(resource); err != nil {
+			return err
+		}
+
+		err := eachPage(ctx, s, resource, includeDeleted, func(records [][]any) error {
+			for _, values := range records {
+				if err := enc.record(resource, values); err != nil {
+					return err
+				}
+			}
+
+			return flush(w)
+		})
+
+		if err != nil {
+			return fmt.Errorf("failed to export %s - %w", resource, err)
+		}
+
+		if err := enc.end(resource); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.footer(); err != nil {
+		return err
+	}
+
+	return flush(w)
+}
+
+func newEncoder(w io.Writer, format Format) (encoder, error) {
+	switch format {
+	case JSON:
+		return &jsonEncoder{w: w}, nil
+	case NDJSON:
+		return &ndjsonEncoder{w: w}, nil
+	case CSV:
+		return newCSVEncoder(w), nil
+	case SQL:
+		return &sqlEncoder{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func flush(w io.Writer) error {
+	if f, ok := w.(flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// eachPage calls fn with the values of each page of records of resource,
+// in ID order
+func eachPage(ctx context.Context, s *store.Store, resource string, includeDeleted bool, fn func(records [][]any) error) error {
+	after := 0
+
+	for {
+		records, last, err := readPage(ctx, s, resource, store.ListOptions{After: after, Limit: pageSize, IncludeDeleted: includeDeleted})
+
+		if err != nil {
+			return err
+		}
+
+		if len(records) == 0 {
+			return nil
+		}
+
+		if err := fn(records); err != nil {
+			return err
+		}
+
+		if len(records) < pageSize {
+			return nil
+		}
+
+		after = last
+	}
+}
+
+// readPage returns the values of a page of records and the ID of the last one
+func readPage(ctx context.Context, s *store.Store, resource string, opts store.ListOptions) ([][]any, int, error) {
+	records := [][]any{}
+	last := 0
+
+	switch resource {
+	case store.ResourceSpecies:
+		species, _, err := s.Species.List(ctx, opts)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, record := range species {
+			records = append(records, []any{record.ID, record.Name, deletedAt(record.DeletedAt)})
+			last = record.ID
+		}
+	case store.ResourceGenders:
+		genders, _, err := s.Genders.List(ctx, opts)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, record := range genders {
+			records = append(records, []any{record.ID, record.Name, deletedAt(record.DeletedAt)})
+			last = record.ID
+		}
+	case store.ResourceCharacters:
+		characters, _, err := s.Characters.List(ctx, store.CharacterFilter{}, opts)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, record := range characters {
+			var species, gender any
+
+			if record.Species != nil {
+				species = record.Species.ID
+			}
+
+			if record.Gender != nil {
+				gender = record.Gender.ID
+			}
+
+			records = append(records, []any{record.ID, record.Name, species, gender, record.Class, deletedAt(record.DeletedAt)})
+			last = record.ID
+		}
+	}
+
+	return records, last, nil
+}
+
+// deletedAt returns the value written for when a record was deleted
+func deletedAt(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+
+	return t.UTC()
+}
@@ -0,0 +1,299 @@
+package exporter_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/njwong/me-api/database"
+	"github.com/njwong/me-api/exporter"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// Names that break SQL literals that only double quotes, especially in
+// MySQL, which reads backslashes as escapes
+var hostileNames = []string{
+	"O'Brien",
+	`back\slash`,
+	`\'); DROP TABLE characters; --`,
+	"line\nbreak\r\n",
+	"nul\x00byte",
+	"ctrl-z\x1a",
+	"tab\tand unicode é☃",
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newSQLiteDB opens a new, migrated SQLite database
+func newSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, dialect, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	mustDo(t, err)
+
+	t.Cleanup(func() { db.Close() })
+
+	_, err = database.MigrateUp(db, dialect)
+	mustDo(t, err)
+
+	return db
+}
+
+// fill adds a species for each hostile name, with a character of each, and
+// a deleted gender that one character has lost
+func fill(t *testing.T, s *store.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	gender := models.Gender{Name: "Female"}
+	mustDo(t, s.Genders.Create(ctx, &gender))
+
+	for _, name := range hostileNames {
+		species := models.Species{Name: name}
+		mustDo(t, s.Species.Create(ctx, &species))
+
+		character := models.Character{Name: name, Species: species.ID, Gender: gender.ID, Class: name}
+		mustDo(t, s.Characters.Create(ctx, &character))
+	}
+
+	mustDo(t, s.Characters.Delete(ctx, 1))
+	mustDo(t, s.Genders.Delete(ctx, gender.ID, store.DeleteOptions{Policy: store.Nullify}))
+}
+
+func export(t *testing.T, s *store.Store, format exporter.Format) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mustDo(t, exporter.Write(context.Background(), &buf, s, format, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), true))
+
+	return buf.String()
+}
+
+// TestWriteSQL loads an SQL export into a new database and checks that it
+// holds the same records
+func TestWriteSQL(t *testing.T) {
+	ctx := context.Background()
+	source := store.NewSQL(newSQLiteDB(t))
+	fill(t, source)
+
+	script := export(t, source, exporter.SQL)
+
+	// Every value is on one line without backslashes, so MySQL reads the
+	// script the same way
+	if strings.Contains(script, `\`) || strings.ContainsAny(script, "\x00\x1a\r") {
+		t.Errorf("script has characters MySQL would escape:\n%q", script)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(script), "\n") {
+		if !strings.HasPrefix(line, "--") && !strings.HasSuffix(line, ";") {
+			t.Errorf("statement spans lines: %q", line)
+		}
+	}
+
+	db := newSQLiteDB(t)
+
+	_, err := db.Exec(script)
+	mustDo(t, err)
+
+	target := store.NewSQL(db)
+	all := store.ListOptions{IncludeDeleted: true}
+
+	for _, list := range []func(s *store.Store) (any, error){
+		func(s *store.Store) (any, error) { records, _, err := s.Species.List(ctx, all); return records, err },
+		func(s *store.Store) (any, error) { records, _, err := s.Genders.List(ctx, all); return records, err },
+		func(s *store.Store) (any, error) {
+			records, _, err := s.Characters.List(ctx, store.CharacterFilter{}, all)
+			return records, err
+		},
+	} {
+		want, err := list(source)
+		mustDo(t, err)
+
+		got, err := list(target)
+		mustDo(t, err)
+
+		if !reflect.DeepEqual(truncate(t, got), truncate(t, want)) {
+			t.Errorf("loaded %+v, want %+v", got, want)
+		}
+	}
+}
+
+// truncate encodes records as JSON with their deletion times to the
+// microsecond, the precision the SQL export keeps
+func truncate(t *testing.T, records any) string {
+	t.Helper()
+
+	data, err := json.Marshal(records)
+	mustDo(t, err)
+
+	var values []map[string]any
+	mustDo(t, json.Unmarshal(data, &values))
+
+	for _, value := range values {
+		if deleted, ok := value["deleted_at"].(string); ok {
+			parsed, err := time.Parse(time.RFC3339Nano, deleted)
+			mustDo(t, err)
+
+			value["deleted_at"] = parsed.Truncate(time.Microsecond).UTC()
+		}
+	}
+
+	data, err = json.Marshal(values)
+	mustDo(t, err)
+
+	return string(data)
+}
+
+func TestWriteJSON(t *testing.T) {
+	s := store.NewMemory()
+	fill(t, s)
+
+	var document struct {
+		SchemaVersion int              `json:"schema_version"`
+		ExportedAt    time.Time        `json:"exported_at"`
+		Species       []map[string]any `json:"species"`
+		Genders       []map[string]any `json:"genders"`
+		Characters    []map[string]any `json:"characters"`
+	}
+
+	mustDo(t, json.Unmarshal([]byte(export(t, s, exporter.JSON)), &document))
+
+	if document.SchemaVersion != exporter.SchemaVersion || len(document.Species) != len(hostileNames) {
+		t.Fatalf("got schema version %d and %d species", document.SchemaVersion, len(document.Species))
+	}
+
+	for i, name := range hostileNames {
+		if document.Species[i]["name"] != name || document.Characters[i]["class"] != name {
+			t.Errorf("got species %q and class %q, want %q", document.Species[i]["name"], document.Characters[i]["class"], name)
+		}
+	}
+
+	if len(document.Genders) != 1 || document.Genders[0]["deleted_at"] == nil {
+		t.Errorf("got genders %v, want the deleted gender", document.Genders)
+	}
+
+	first, second := document.Characters[0], document.Characters[1]
+
+	if first["deleted_at"] == nil || second["deleted_at"] != nil || second["gender"] != nil {
+		t.Errorf("got characters %v and %v", first, second)
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	s := store.NewMemory()
+	fill(t, s)
+
+	lines := strings.Split(strings.TrimSpace(export(t, s, exporter.NDJSON)), "\n")
+
+	if len(lines) != 1+2*len(hostileNames)+1 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+
+	var character map[string]any
+	mustDo(t, json.Unmarshal([]byte(lines[len(lines)-1]), &character))
+
+	if character["resource"] != store.ResourceCharacters || character["name"] != hostileNames[len(hostileNames)-1] {
+		t.Errorf("got last line %v", character)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	s := store.NewMemory()
+	fill(t, s)
+
+	data := export(t, s, exporter.CSV)
+
+	comment, body, _ := strings.Cut(data, "\n")
+
+	if comment != "# schema_version=1 exported_at=2024-05-01T12:00:00Z" {
+		t.Errorf("got header comment %q", comment)
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	mustDo(t, err)
+
+	want := []string{"characters", "1", hostileNames[0], "1", "", hostileNames[0]}
+
+	if got := rows[len(hostileNames)+2]; !reflect.DeepEqual(got[:6], want) || got[6] == "" {
+		t.Errorf("got row %q, want %q with a deletion time", got, want)
+	}
+}
+
+func TestWriteWithoutDeleted(t *testing.T) {
+	s := store.NewMemory()
+	fill(t, s)
+
+	var buf bytes.Buffer
+	mustDo(t, exporter.Write(context.Background(), &buf, s, exporter.NDJSON, time.Now(), false))
+
+	if strings.Contains(buf.String(), "Female") || strings.Contains(buf.String(), `"deleted_at":"`) {
+		t.Errorf("got deleted records in\n%s", buf.String())
+	}
+
+	if lines := strings.Count(buf.String(), "\n"); lines != 1+2*len(hostileNames)-1 {
+		t.Errorf("got %d lines", lines)
+	}
+}
+
+// blockingWriter creates a gender on the first write, as a change made
+// while a slow client is still downloading the export
+type blockingWriter struct {
+	t       *testing.T
+	s       *store.Store
+	written bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.written = true
+		done := make(chan error, 1)
+
+		go func() {
+			done <- w.s.Genders.Create(context.Background(), &models.Gender{Name: "Male"})
+		}()
+
+		select {
+		case err := <-done:
+			mustDo(w.t, err)
+		case <-time.After(5 * time.Second):
+			w.t.Fatal("write blocked while the export was being written")
+		}
+	}
+
+	return len(p), nil
+}
+
+// TestWriteDoesNotBlockWrites checks that no lock is held on the store
+// while the export is written
+func TestWriteDoesNotBlockWrites(t *testing.T) {
+	for name, s := range map[string]*store.Store{
+		"memory": store.NewMemory(),
+		"sqlite": store.NewSQL(newSQLiteDB(t)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			fill(t, s)
+
+			w := &blockingWriter{t: t, s: s}
+			mustDo(t, exporter.Write(context.Background(), w, s, exporter.JSON, time.Now(), true))
+
+			if !w.written {
+				t.Error("nothing was written")
+			}
+		})
+	}
+}
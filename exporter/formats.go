@@ -0,0 +1,256 @@
+package exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// object encodes the values of a record as a JSON object, keeping the
+// fields in column order
+func object(columns []string, values []any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for i, column := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(values[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) header(h header) error {
+	_, err := fmt.Fprintf(e.w, "{\"schema_version\":%d,\"exported_at\":%q", h.SchemaVersion, h.ExportedAt.Format(time.RFC3339Nano))
+	return err
+}
+
+func (e *jsonEncoder) begin(resource string) error {
+	e.count = 0
+	_, err := fmt.Fprintf(e.w, ",\n%q:[", resource)
+	return err
+}
+
+func (e *jsonEncoder) record(resource string, values []any) error {
+	data, err := object(columns[resource], values)
+
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+
+	if e.count == 0 {
+		separator = "\n"
+	}
+
+	e.count++
+
+	_, err = fmt.Fprintf(e.w, "%s%s", separator, data)
+	return err
+}
+
+func (e *jsonEncoder) end(resource string) error {
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+func (e *jsonEncoder) footer() error {
+	_, err := io.WriteString(e.w, "}\n")
+	return err
+}
+
+type ndjsonEncoder struct {
+	w io.Writer
+}
+
+func (e *ndjsonEncoder) header(h header) error {
+	return json.NewEncoder(e.w).Encode(h)
+}
+
+func (e *ndjsonEncoder) begin(resource string) error {
+	return nil
+}
+
+func (e *ndjsonEncoder) record(resource string, values []any) error {
+	// Lead with the resource so each line stands on its own
+	data, err := object(append([]string{"resource"}, columns[resource]...), append([]any{resource}, values...))
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(e.w, "%s\n", data)
+	return err
+}
+
+func (e *ndjsonEncoder) end(resource string) error {
+	return nil
+}
+
+func (e *ndjsonEncoder) footer() error {
+	return nil
+}
+
+// csvColumns are the columns of every CSV export, covering the fields of all
+// the resources
+var csvColumns = []string{"resource", "id", "name", "species", "gender", "class", "deleted_at"}
+
+type csvEncoder struct {
+	w      io.Writer
+	writer *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer) *csvEncoder {
+	return &csvEncoder{w: w, writer: csv.NewWriter(w)}
+}
+
+func (e *csvEncoder) header(h header) error {
+	_, err := fmt.Fprintf(e.w, "# schema_version=%d exported_at=%s\n", h.SchemaVersion, h.ExportedAt.Format(time.RFC3339Nano))
+
+	if err != nil {
+		return err
+	}
+
+	return e.write(csvColumns)
+}
+
+func (e *csvEncoder) begin(resource string) error {
+	return nil
+}
+
+func (e *csvEncoder) record(resource string, values []any) error {
+	row := make([]string, len(csvColumns))
+	row[0] = resource
+
+	for i, column := range columns[resource] {
+		for j, name := range csvColumns {
+			if name == column {
+				row[j] = text(values[i])
+			}
+		}
+	}
+
+	return e.write(row)
+}
+
+func (e *csvEncoder) end(resource string) error {
+	return nil
+}
+
+func (e *csvEncoder) footer() error {
+	return nil
+}
+
+// write writes a row straight through, so the CSV writer's buffer is always
+// empty when the underlying writer is flushed
+func (e *csvEncoder) write(row []string) error {
+	if err := e.writer.Write(row); err != nil {
+		return err
+	}
+
+	e.writer.Flush()
+
+	return e.writer.Error()
+}
+
+// text formats a value for CSV, where nil is an empty cell
+func text(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case int:
+		return strconv.Itoa(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+type sqlEncoder struct {
+	w io.Writer
+}
+
+func (e *sqlEncoder) header(h header) error {
+	_, err := fmt.Fprintf(e.w, "-- schema_version=%d exported_at=%s\n-- Load into an empty database after running \"migrate up\"\nBEGIN;\n", h.SchemaVersion, h.ExportedAt.Format(time.RFC3339Nano))
+	return err
+}
+
+func (e *sqlEncoder) begin(resource string) error {
+	return nil
+}
+
+func (e *sqlEncoder) record(resource string, values []any) error {
+	literals := make([]string, len(values))
+
+	for i, value := range values {
+		literals[i] = literal(value)
+	}
+
+	_, err := fmt.Fprintf(e.w, "INSERT INTO %s (%s) VALUES (%s);\n", resource, strings.Join(columns[resource], ", "), strings.Join(literals, ", "))
+	return err
+}
+
+func (e *sqlEncoder) end(resource string) error {
+	return nil
+}
+
+func (e *sqlEncoder) footer() error {
+	_, err := io.WriteString(e.w, "COMMIT;\n")
+	return err
+}
+
+// literal formats a value as an SQL literal. MySQL reads backslashes in
+// strings as escapes and SQLite doesn't, so strings with backslashes or
+// control characters are written as hex literals, which both read as text
+// when cast to CHAR. Quotes are the only other character that needs
+// escaping, and are doubled.
+func literal(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "NULL"
+	case int:
+		return strconv.Itoa(value)
+	case time.Time:
+		return "'" + value.Format("2006-01-02 15:04:05.999999") + "'"
+	default:
+		text := fmt.Sprint(value)
+
+		if strings.IndexFunc(text, unsafeRune) >= 0 {
+			return fmt.Sprintf("CAST(X'%X' AS CHAR)", text)
+		}
+
+		return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+	}
+}
+
+// unsafeRune reports whether r can't be written as is in a quoted string
+func unsafeRune(r rune) bool {
+	return r == '\\' || r < 0x20 || r == 0x7f
+}
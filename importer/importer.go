@@ -0,0 +1,432 @@
+// Package importer loads characters, species and genders in bulk from CSV,
+// JSON or NDJSON files.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+	"github.com/njwong/me-api/validation"
+)
+
+// ErrInvalidRows is returned with a report listing the errors when any row
+// can't be imported, in which case nothing is written
+var ErrInvalidRows = errors.New("import has invalid rows")
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// Resources lists the resources that can be imported
+var Resources = []string{store.ResourceCharacters, store.ResourceGenders, store.ResourceSpecies}
+
+// Fields each resource is imported from. Species and genders of characters
+// are given by name, or by ID if the value is a number.
+var resourceFields = map[string][]string{
+	store.ResourceCharacters: {"name", "species", "gender", "class"},
+	store.ResourceGenders:    {"name"},
+	store.ResourceSpecies:    {"name"},
+}
+
+// Fields that are accepted but ignored, as the store assigns them
+var ignoredFields = []string{"id", "url"}
+
+// Actions taken for a row
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+)
+
+// Report describes the outcome of an import. Errors name the field of the
+// row they apply to, e.g. rows[3].species.
+type Report struct {
+	DryRun    bool                    `json:"dry_run"`
+	Applied   bool                    `json:"applied"`
+	Created   int                     `json:"created"`
+	Updated   int                     `json:"updated"`
+	Unchanged int                     `json:"unchanged"`
+	Results   []Result                `json:"results"`
+	Errors    []validation.FieldError `json:"errors"`
+}
+
+// Result is the action taken for a row. ID is left out for records that
+// would have been created if the import had been applied.
+type Result struct {
+	Row    int    `json:"row"`
+	Action string `json:"action"`
+	ID     int    `json:"id,omitempty"`
+}
+
+// Run imports rows into the resource in a single transaction. Records are
+// matched to existing ones by name, ignoring case and deleted records, so
+// species and genders are only created if they are new, and characters are
+// created or updated. Nothing is written if any row is invalid, and a dry
+// run reports what would happen and then rolls back.
+func Run(ctx context.Context, s *store.Store, resource string, rows []Row, dryRun bool) (*Report, error) {
+	if _, ok := resourceFields[resource]; !ok {
+		return nil, fmt.Errorf("unknown resource %q", resource)
+	}
+
+	var report *Report
+
+	err := s.Transaction(ctx, func(tx *store.Store) error {
+		report = &Report{DryRun: dryRun, Results: []Result{}, Errors: []validation.FieldError{}}
+
+		var err error
+
+		switch resource {
+		case store.ResourceCharacters:
+			err = importCharacters(ctx, tx, rows, report)
+		case store.ResourceGenders:
+			err = importNamed(ctx, resource, tx.Genders.List, genderName, createGender(ctx, tx.Genders), rows, report)
+		case store.ResourceSpecies:
+			err = importNamed(ctx, resource, tx.Species.List, speciesName, createSpecies(ctx, tx.Species), rows, report)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(report.Errors) > 0 {
+			return ErrInvalidRows
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, ErrInvalidRows):
+		report.rolledBack()
+		return report, err
+	case errors.Is(err, errDryRun):
+		report.rolledBack()
+		return report, nil
+	case err != nil:
+		return nil, err
+	}
+
+	report.Applied = true
+
+	return report, nil
+}
+
+// rolledBack clears the IDs of created records, which no longer exist
+func (r *Report) rolledBack() {
+	for i := range r.Results {
+		if r.Results[i].Action == ActionCreate {
+			r.Results[i].ID = 0
+		}
+	}
+}
+
+// addResult records the action taken for a row
+func (r *Report) addResult(row Row, action string, id int) {
+	switch action {
+	case ActionCreate:
+		r.Created++
+	case ActionUpdate:
+		r.Updated++
+	default:
+		r.Unchanged++
+	}
+
+	r.Results = append(r.Results, Result{Row: row.Number, Action: action, ID: id})
+}
+
+// addErrors records the errors of a row, naming their fields after it
+func (r *Report) addErrors(row Row, errors []validation.FieldError) {
+	for _, err := range errors {
+		r.Errors = append(r.Errors, validation.FieldError{
+			Field:   fmt.Sprintf("rows[%d].%s", row.Number, err.Field),
+			Message: err.Message,
+		})
+	}
+}
+
+// checkFields returns errors for the values that couldn't be read and for
+// fields the resource doesn't have, in order of field name
+func checkFields(row Row, resource string) []validation.FieldError {
+	errors := append([]validation.FieldError{}, row.Errors...)
+
+	for name := range row.Fields {
+		if !contains(resourceFields[resource], name) && !contains(ignoredFields, name) {
+			errors = append(errors, validation.FieldError{Field: name, Message: "is not a known field"})
+		}
+	}
+
+	sort.Slice(errors, func(i, j int) bool { return errors[i].Field < errors[j].Field })
+
+	return errors
+}
+
+// names maps names, by their models.NameKey, to the IDs of the records with
+// that name
+type names map[string][]int
+
+func (n names) add(name string, id int) {
+	key := models.NameKey(name)
+	n[key] = append(n[key], id)
+}
+
+// resolve finds the record a value refers to, by ID if it is a number and
+// otherwise by name. It returns 0 and an error message if there isn't
+// exactly one.
+func (n names) resolve(value string, ids map[int]bool, resource string) (int, string) {
+	if value == "" {
+		return 0, ""
+	}
+
+	if id, err := strconv.Atoi(value); err == nil {
+		if !ids[id] {
+			return 0, "is not a known " + resource
+		}
+
+		return id, ""
+	}
+
+	switch matches := n[models.NameKey(value)]; len(matches) {
+	case 0:
+		return 0, "is not a known " + resource
+	case 1:
+		return matches[0], ""
+	default:
+		return 0, "matches more than one " + resource
+	}
+}
+
+// importNamed imports species or genders, which only have a name. Existing
+// records are left unchanged.
+func importNamed[T any](
+	ctx context.Context,
+	resource string,
+	list func(ctx context.Context, opts store.ListOptions) ([]T, int, error),
+	idAndName func(T) (int, string),
+	create func(name string) (int, error),
+	rows []Row,
+	report *Report,
+) error {
+	current, _, err := listNames(ctx, list, idAndName)
+
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]int{}
+
+	for _, row := range rows {
+		name := strings.TrimSpace(row.Fields["name"])
+		errors := checkFields(row, resource)
+		// Species and genders have the same rules for their names
+		errors = append(errors, validation.Struct(models.Gender{Name: name})...)
+
+		if first, ok := seen[models.NameKey(name)]; ok && name != "" {
+			errors = append(errors, validation.FieldError{Field: "name", Message: fmt.Sprintf("repeats row %d", first)})
+		} else {
+			seen[models.NameKey(name)] = row.Number
+		}
+
+		if len(errors) > 0 {
+			report.addErrors(row, errors)
+			continue
+		}
+
+		if matches := current[models.NameKey(name)]; len(matches) > 0 {
+			report.addResult(row, ActionUnchanged, matches[0])
+			continue
+		}
+
+		id, err := create(name)
+
+		if err != nil {
+			return fmt.Errorf("row %d - %w", row.Number, err)
+		}
+
+		report.addResult(row, ActionCreate, id)
+	}
+
+	return nil
+}
+
+// speciesName and genderName return the ID and name of a species or gender
+func speciesName(species models.Species) (int, string) {
+	return species.ID, species.Name
+}
+
+func genderName(gender models.Gender) (int, string) {
+	return gender.ID, gender.Name
+}
+
+func createSpecies(ctx context.Context, speciesStore store.SpeciesStore) func(name string) (int, error) {
+	return func(name string) (int, error) {
+		species := models.Species{Name: name}
+		err := speciesStore.Create(ctx, &species)
+		return species.ID, err
+	}
+}
+
+func createGender(ctx context.Context, genderStore store.GenderStore) func(name string) (int, error) {
+	return func(name string) (int, error) {
+		gender := models.Gender{Name: name}
+		err := genderStore.Create(ctx, &gender)
+		return gender.ID, err
+	}
+}
+
+// importCharacters creates new characters and updates those whose species,
+// gender or class have changed
+func importCharacters(ctx context.Context, tx *store.Store, rows []Row, report *Report) error {
+	species, speciesIDs, err := listNames(ctx, tx.Species.List, speciesName)
+
+	if err != nil {
+		return err
+	}
+
+	genders, genderIDs, err := listNames(ctx, tx.Genders.List, genderName)
+
+	if err != nil {
+		return err
+	}
+
+	existing, _, err := tx.Characters.List(ctx, store.CharacterFilter{}, store.ListOptions{})
+
+	if err != nil {
+		return err
+	}
+
+	characters := map[string][]models.CharacterObject{}
+
+	for _, character := range existing {
+		key := models.NameKey(character.Name)
+		characters[key] = append(characters[key], character)
+	}
+
+	seen := map[string]int{}
+
+	for _, row := range rows {
+		character := models.Character{
+			Name:  strings.TrimSpace(row.Fields["name"]),
+			Class: strings.TrimSpace(row.Fields["class"]),
+		}
+
+		errors := checkFields(row, store.ResourceCharacters)
+
+		var message string
+
+		character.Species, message = species.resolve(strings.TrimSpace(row.Fields["species"]), speciesIDs, "species")
+
+		if message != "" {
+			errors = append(errors, validation.FieldError{Field: "species", Message: message})
+		}
+
+		character.Gender, message = genders.resolve(strings.TrimSpace(row.Fields["gender"]), genderIDs, "gender")
+
+		if message != "" {
+			errors = append(errors, validation.FieldError{Field: "gender", Message: message})
+		}
+
+		for _, err := range validation.Struct(character) {
+			if !hasField(errors, err.Field) {
+				errors = append(errors, err)
+			}
+		}
+
+		key := models.NameKey(character.Name)
+
+		if first, ok := seen[key]; ok && character.Name != "" {
+			errors = append(errors, validation.FieldError{Field: "name", Message: fmt.Sprintf("repeats row %d", first)})
+		} else {
+			seen[key] = row.Number
+		}
+
+		matches := characters[key]
+
+		if len(matches) > 1 {
+			errors = append(errors, validation.FieldError{Field: "name", Message: "matches more than one character"})
+		}
+
+		if len(errors) > 0 {
+			report.addErrors(row, errors)
+			continue
+		}
+
+		if len(matches) == 1 && matches[0].Matches(character) {
+			report.addResult(row, ActionUnchanged, matches[0].ID)
+			continue
+		}
+
+		action := ActionCreate
+
+		if len(matches) == 1 {
+			action = ActionUpdate
+			character.ID = matches[0].ID
+		}
+
+		if action == ActionCreate {
+			err = tx.Characters.Create(ctx, &character)
+		} else {
+			err = tx.Characters.Update(ctx, character.ID, &character)
+		}
+
+		if err != nil {
+			return fmt.Errorf("row %d - %w", row.Number, err)
+		}
+
+		report.addResult(row, action, character.ID)
+	}
+
+	return nil
+}
+
+// listNames lists the species or genders that characters can refer to
+func listNames[T any](
+	ctx context.Context,
+	list func(ctx context.Context, opts store.ListOptions) ([]T, int, error),
+	idAndName func(T) (int, string),
+) (names, map[int]bool, error) {
+	records, _, err := list(ctx, store.ListOptions{})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byName := names{}
+	ids := map[int]bool{}
+
+	for _, record := range records {
+		id, name := idAndName(record)
+		byName.add(name, id)
+		ids[id] = true
+	}
+
+	return byName, ids, nil
+}
+
+func hasField(errors []validation.FieldError, field string) bool {
+	for _, err := range errors {
+		if err.Field == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(items []string, target string) bool {
+	for _, item := range items {
+		if item == target {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,268 @@
+package importer_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/njwong/me-api/importer"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/seed"
+	"github.com/njwong/me-api/store"
+)
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func parse(t *testing.T, format importer.Format, data string) []importer.Row {
+	t.Helper()
+
+	rows, err := importer.Parse(strings.NewReader(data), format)
+	mustDo(t, err)
+
+	return rows
+}
+
+// TestParse checks that each format reads the same file into the same rows
+func TestParse(t *testing.T) {
+	want := []importer.Row{
+		{Number: 1, Fields: map[string]string{"name": "Garrus", "species": "2", "class": ""}},
+		{Number: 2, Fields: map[string]string{"name": "Tali, Zorah", "species": "Quarian", "class": "Engineer"}},
+	}
+
+	files := map[importer.Format]string{
+		importer.CSV:    "name, species, class\nGarrus,2,\n\"Tali, Zorah\",Quarian,Engineer\n",
+		importer.JSON:   `[{"name":"Garrus","species":2,"class":null},{"name":"Tali, Zorah","species":"Quarian","class":"Engineer"}]`,
+		importer.NDJSON: "{\"name\":\"Garrus\",\"species\":2,\"class\":null}\n\n{\"name\":\"Tali, Zorah\",\"species\":\"Quarian\",\"class\":\"Engineer\"}\n",
+	}
+
+	for format, data := range files {
+		if got := parse(t, format, data); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s gave %+v, want %+v", format, got, want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	if _, err := importer.Parse(strings.NewReader(`{"name":"Garrus"}`), importer.JSON); err == nil {
+		t.Error("expected an error for a JSON object instead of an array")
+	}
+
+	if _, err := importer.Parse(strings.NewReader("{\"name\":\"Garrus\"}\n[1]\n"), importer.NDJSON); err == nil {
+		t.Error("expected an error for an NDJSON line that isn't an object")
+	}
+
+	rows := parse(t, importer.JSON, `[{"name":{"first":"Garrus"}}]`)
+
+	if len(rows[0].Errors) != 1 || rows[0].Errors[0].Field != "name" {
+		t.Errorf("got errors %v, want one for name", rows[0].Errors)
+	}
+}
+
+// newStore returns a store with a species and gender to refer to
+func newStore(t *testing.T) (*store.Store, models.Species, models.Gender) {
+	t.Helper()
+
+	ctx := context.Background()
+	s := store.NewMemory()
+
+	species := models.Species{Name: "Turian"}
+	mustDo(t, s.Species.Create(ctx, &species))
+
+	gender := models.Gender{Name: "Male"}
+	mustDo(t, s.Genders.Create(ctx, &gender))
+
+	return s, species, gender
+}
+
+func TestRunCharacters(t *testing.T) {
+	ctx := context.Background()
+	s, species, gender := newStore(t)
+
+	garrus := models.Character{Name: "Garrus", Species: species.ID, Gender: gender.ID, Class: "Sniper"}
+	mustDo(t, s.Characters.Create(ctx, &garrus))
+
+	saren := models.Character{Name: "Saren", Species: species.ID, Gender: gender.ID}
+	mustDo(t, s.Characters.Create(ctx, &saren))
+
+	rows := parse(t, importer.CSV, "id,name,species,gender,class\n"+
+		",garrus,Turian,male,Sniper\n"+
+		",Saren,turian,Male,Spectre\n"+
+		",Nihlus,1,,Spectre\n")
+
+	report, err := importer.Run(ctx, s, store.ResourceCharacters, rows, false)
+	mustDo(t, err)
+
+	want := []importer.Result{
+		{Row: 1, Action: importer.ActionUpdate, ID: garrus.ID},
+		{Row: 2, Action: importer.ActionUpdate, ID: saren.ID},
+		{Row: 3, Action: importer.ActionCreate, ID: saren.ID + 1},
+	}
+
+	if !report.Applied || !reflect.DeepEqual(report.Results, want) {
+		t.Errorf("got %+v, want %+v applied", report.Results, want)
+	}
+
+	stored, err := s.Characters.Get(ctx, garrus.ID)
+	mustDo(t, err)
+
+	if stored.Name != "garrus" {
+		t.Errorf("name was updated to %q, want %q", stored.Name, "garrus")
+	}
+
+	nihlus, err := s.Characters.Get(ctx, saren.ID+1)
+	mustDo(t, err)
+
+	if nihlus.Gender != nil {
+		t.Errorf("got gender %d, want none", nihlus.Gender.ID)
+	}
+
+	// Importing the same rows again changes nothing
+	report, err = importer.Run(ctx, s, store.ResourceCharacters, rows, false)
+	mustDo(t, err)
+
+	if report.Unchanged != 3 {
+		t.Errorf("got %+v, want every row unchanged", report.Results)
+	}
+}
+
+func TestRunInvalidRows(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newStore(t)
+
+	rows := parse(t, importer.NDJSON, `{"name":"Garrus","species":"Turian"}
+{"name":"Tali","species":"Quarian"}
+{"name":"garrus","species":99,"rank":"Officer"}
+`)
+
+	report, err := importer.Run(ctx, s, store.ResourceCharacters, rows, false)
+
+	if !errors.Is(err, importer.ErrInvalidRows) {
+		t.Fatalf("got %v, want %v", err, importer.ErrInvalidRows)
+	}
+
+	fields := []string{}
+
+	for _, fieldError := range report.Errors {
+		fields = append(fields, fieldError.Field)
+	}
+
+	want := []string{"rows[2].species", "rows[3].rank", "rows[3].species", "rows[3].name"}
+
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got errors for %v, want %v", fields, want)
+	}
+
+	if report.Applied || report.Results[0].ID != 0 {
+		t.Errorf("got %+v, want nothing applied", report)
+	}
+
+	_, total, err := s.Characters.List(ctx, store.CharacterFilter{}, store.ListOptions{})
+	mustDo(t, err)
+
+	if total != 0 {
+		t.Errorf("got %d characters, want none", total)
+	}
+}
+
+func TestRunNamedDryRun(t *testing.T) {
+	ctx := context.Background()
+	s, species, _ := newStore(t)
+
+	rows := parse(t, importer.JSON, `[{"name":"turian"},{"name":"Asari"}]`)
+
+	report, err := importer.Run(ctx, s, store.ResourceSpecies, rows, true)
+	mustDo(t, err)
+
+	want := []importer.Result{
+		{Row: 1, Action: importer.ActionUnchanged, ID: species.ID},
+		{Row: 2, Action: importer.ActionCreate},
+	}
+
+	if report.Applied || !reflect.DeepEqual(report.Results, want) {
+		t.Errorf("got %+v, want %+v not applied", report.Results, want)
+	}
+
+	_, total, err := s.Species.List(ctx, store.ListOptions{})
+	mustDo(t, err)
+
+	if total != 1 {
+		t.Errorf("dry run left %d species, want 1", total)
+	}
+}
+
+// TestRunMatchesSeed checks that the importer and the seed agree on which
+// characters are unchanged
+func TestRunMatchesSeed(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+
+	dataset := &seed.Dataset{
+		Species: []string{"Turian"},
+		Genders: []string{"Male", "Female"},
+		Characters: []seed.DatasetCharacter{
+			{Name: "Garrus", Species: "Turian", Gender: "Male", Class: "Sniper"},
+			{Name: "Saren", Species: "Turian", Gender: "Male"},
+		},
+	}
+
+	_, err := seed.Run(ctx, s, dataset)
+	mustDo(t, err)
+
+	rows := parse(t, importer.CSV, "name,species,gender,class\nGarrus,Turian,Male,Sniper\nSaren,Turian,Male,\n")
+
+	report, err := importer.Run(ctx, s, store.ResourceCharacters, rows, false)
+	mustDo(t, err)
+
+	if report.Unchanged != 2 {
+		t.Errorf("import after seed gave %+v, want every row unchanged", report.Results)
+	}
+
+	result, err := seed.Run(ctx, s, dataset)
+	mustDo(t, err)
+
+	if result.Updated != 0 {
+		t.Errorf("seed after import updated %d records", result.Updated)
+	}
+}
+
+// TestSeedAfterImportIgnoresCase checks that the seed matches imported
+// records by name ignoring case, like the importer, rather than duplicating
+// them
+func TestSeedAfterImportIgnoresCase(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+
+	_, err := importer.Run(ctx, s, store.ResourceSpecies, parse(t, importer.CSV, "name\nturian\n"), false)
+	mustDo(t, err)
+
+	dataset := &seed.Dataset{
+		Species:    []string{"Turian"},
+		Genders:    []string{"Male"},
+		Characters: []seed.DatasetCharacter{{Name: "Garrus", Species: "Turian", Gender: "male"}},
+	}
+
+	result, err := seed.Run(ctx, s, dataset)
+	mustDo(t, err)
+
+	species, total, err := s.Species.List(ctx, store.ListOptions{})
+	mustDo(t, err)
+
+	if total != 1 || result.Created != 2 {
+		t.Fatalf("seed created %d records, leaving species %+v", result.Created, species)
+	}
+
+	garrus, _, err := s.Characters.List(ctx, store.CharacterFilter{}, store.ListOptions{})
+	mustDo(t, err)
+
+	if garrus[0].SpeciesID() != species[0].ID || garrus[0].Gender == nil {
+		t.Errorf("got character %+v", garrus[0])
+	}
+}
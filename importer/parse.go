@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/njwong/me-api/validation"
+)
+
+// Format is the encoding of an import file
+type Format string
+
+const (
+	// CSV has a header row naming the field in each column
+	CSV Format = "csv"
+
+	// JSON is an array of objects
+	JSON Format = "json"
+
+	// NDJSON has one object per line
+	NDJSON Format = "ndjson"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{CSV, JSON, NDJSON}
+
+// Media types of the supported formats
+var mediaTypes = map[string]Format{
+	"text/csv":             CSV,
+	"application/json":     JSON,
+	"application/x-ndjson": NDJSON,
+	"application/ndjson":   NDJSON,
+}
+
+// FormatForMediaType returns the format of a request body with the given
+// media type, without parameters
+func FormatForMediaType(mediaType string) (Format, bool) {
+	format, ok := mediaTypes[strings.ToLower(mediaType)]
+	return format, ok
+}
+
+// FormatForFile returns the format of a file from its extension
+func FormatForFile(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV, true
+	case ".json":
+		return JSON, true
+	case ".ndjson", ".jsonl":
+		return NDJSON, true
+	default:
+		return "", false
+	}
+}
+
+// Row is a record read from an import file, before it is checked against
+// the resource being imported
+type Row struct {
+	// Number is the position of the record in the file, counting from 1 and
+	// not counting the CSV header
+	Number int
+
+	// Fields holds the value of each field as text, with JSON numbers in
+	// their original form and nulls as empty strings
+	Fields map[string]string
+
+	// Errors lists fields whose values couldn't be read as text
+	Errors []validation.FieldError
+}
+
+// Parse reads the rows of an import file. It fails if the file as a whole
+// can't be read, while invalid values are reported on their row.
+func Parse(r io.Reader, format Format) ([]Row, error) {
+	switch format {
+	case CSV:
+		return parseCSV(r)
+	case JSON:
+		return parseJSON(r)
+	case NDJSON:
+		return parseNDJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if errors.Is(err, io.EOF) {
+		return []Row{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, name := range header {
+		header[i] = strings.TrimSpace(name)
+	}
+
+	rows := []Row{}
+
+	for {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		row := Row{Number: len(rows) + 1, Fields: map[string]string{}}
+
+		for i, value := range record {
+			row.Fields[header[i]] = value
+		}
+
+		rows = append(rows, row)
+	}
+}
+
+func parseJSON(r io.Reader) ([]Row, error) {
+	var objects []json.RawMessage
+
+	if err := json.NewDecoder(r).Decode(&objects); err != nil {
+		return nil, fmt.Errorf("expected an array of objects - %w", err)
+	}
+
+	rows := []Row{}
+
+	for _, object := range objects {
+		row, err := parseObject(len(rows)+1, object)
+
+		if err != nil {
+			return nil, fmt.Errorf("row %d - %w", len(rows)+1, err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func parseNDJSON(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+
+	rows := []Row{}
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		row, err := parseObject(len(rows)+1, scanner.Bytes())
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d - %w", line, err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// parseObject reads a JSON object into a row
+func parseObject(number int, data []byte) (Row, error) {
+	var object map[string]json.RawMessage
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return Row{}, errors.New("expected an object")
+	}
+
+	row := Row{Number: number, Fields: map[string]string{}}
+
+	for name, raw := range object {
+		var value any
+
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&value); err != nil {
+			return Row{}, err
+		}
+
+		switch value := value.(type) {
+		case nil:
+			row.Fields[name] = ""
+		case string:
+			row.Fields[name] = value
+		case json.Number:
+			row.Fields[name] = value.String()
+		default:
+			row.Errors = append(row.Errors, validation.FieldError{Field: name, Message: "must be a string or number"})
+		}
+	}
+
+	return row, nil
+}
@@ -3,16 +3,23 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/joho/godotenv"
 
 	"github.com/njwong/me-api/api"
 	"github.com/njwong/me-api/database"
 	"github.com/njwong/me-api/middleware"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/search"
+	"github.com/njwong/me-api/store"
 )
 
 func main() {
@@ -26,11 +33,39 @@ func main() {
 		}
 	}
 
+	// Run a maintenance command instead of the server if one was given
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1], os.Args[2:])
+		return
+	}
+
 	// Setup the connection to the database
-	database.Setup()
+	stores := database.Setup()
+
+	// Serve repeated reads from memory, the admin routes clear the cache
+	stores, cache := store.WithCache(stores, cacheConfig())
+
+	// Keep the search index up to date with changes made by the admin routes
+	index := search.NewIndex(stores)
+	stores = store.WithWriteHook(stores, index.Invalidate)
+
+	// Serve reads with ?as_of from the revision history, bypassing the cache
+	stores = store.WithPointInTime(stores)
 
 	// Create app
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// Render every error as problem details
+		ErrorHandler: problem.Handler,
+
+		// Only believe the Forwarded and X-Forwarded-* headers of requests
+		// from the proxies listed in TRUSTED_PROXIES, as they end up in links
+		// that shared caches may store
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          trustedProxies(),
+	})
+
+	// Tag each request with an ID, which is recorded with the changes it makes
+	app.Use(requestid.New())
 
 	// Add logger middleware
 	app.Use(logger.New())
@@ -38,25 +73,49 @@ func main() {
 	// Allow requests from any origin
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
+		// Let browser clients read versions for If-Match, new resource URLs
+		// and the schema version of exports
+		ExposeHeaders: fiber.HeaderETag + ", " + fiber.HeaderLocation + ", X-Schema-Version",
 	}))
 
+	// Work out the base URL for links, either from BASE_URL or the request
+	app.Use(middleware.BaseURL(os.Getenv("BASE_URL")))
+
 	// Limit requests to 100 per minute
 	app.Use(limiter.New(limiter.Config{
 		Max:        100,
 		Expiration: 60,
+		LimitReached: func(c *fiber.Ctx) error {
+			return problem.TooManyRequests()
+		},
 	}))
 
+	// Let browsers and CDNs cache the reference data
+	app.Use(
+		[]string{"/api/characters", "/api/genders", "/api/species"},
+		middleware.Conditional(os.Getenv("CACHE_CONTROL")),
+	)
+
+	// Let clients read the data as it was at a past time with ?as_of
+	app.Use([]string{"/api/characters", "/api/genders", "/api/species"}, middleware.AsOf)
+
 	// Add public routes
 	api.AddHealthRoutes(app)
-	api.AddCharactersRoutes(app)
-	api.AddGendersEndpoints(app)
-	api.AddSpeciesEndpoints(app)
+	api.AddCharactersRoutes(app, stores)
+	api.AddGendersEndpoints(app, stores)
+	api.AddSpeciesEndpoints(app, stores)
+	api.AddSearchRoutes(app, index)
+	api.AddExportRoutes(app, stores)
 
 	// Add admin protected routes
 	app.Use(middleware.JWTAuth)
-	api.AddAdminCharacterRoutes(app)
-	api.AddAdminGendersEndpoints(app)
-	api.AddAdminSpeciesEndpoints(app)
+	api.AddAdminCharacterRoutes(app, stores)
+	api.AddAdminGendersEndpoints(app, stores)
+	api.AddAdminSpeciesEndpoints(app, stores)
+	api.AddAdminCacheRoutes(app, cache)
+	api.AddAdminAuditRoutes(app, stores)
+	api.AddAdminImportRoutes(app, stores)
+	api.AddAdminExportRoutes(app, stores)
 
 	// Get the port from the environment
 	port := os.Getenv("PORT")
@@ -68,3 +127,45 @@ func main() {
 	// Run the app listening on the selected port
 	log.Fatal(app.Listen("0.0.0.0:" + port))
 }
+
+// trustedProxies reads the comma separated IPs and CIDR ranges of the
+// proxies in front of the API from TRUSTED_PROXIES
+func trustedProxies() []string {
+	proxies := []string{}
+
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return proxies
+}
+
+// cacheConfig reads the read cache settings from CACHE_TTL, a duration such
+// as "5m" or "0" to disable the cache, and CACHE_SIZE
+func cacheConfig() store.CacheConfig {
+	config := store.CacheConfig{TTL: time.Minute, MaxEntries: 1000}
+
+	if ttl := os.Getenv("CACHE_TTL"); ttl != "" {
+		duration, err := time.ParseDuration(ttl)
+
+		if err != nil {
+			log.Fatal("(main) invalid CACHE_TTL - ", err)
+		}
+
+		config.TTL = duration
+	}
+
+	if size := os.Getenv("CACHE_SIZE"); size != "" {
+		entries, err := strconv.Atoi(size)
+
+		if err != nil {
+			log.Fatal("(main) invalid CACHE_SIZE - ", err)
+		}
+
+		config.MaxEntries = entries
+	}
+
+	return config
+}
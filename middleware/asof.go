@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
+)
+
+// AsOf reads the as_of parameter of GET and HEAD requests, an RFC 3339
+// timestamp such as 2023-06-17T00:00:00Z, so that a store wrapped by
+// store.WithPointInTime returns the records as they were at that time
+func AsOf(c *fiber.Ctx) error {
+	raw := c.Query("as_of")
+
+	if raw == "" || (c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead) {
+		return c.Next()
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+
+	if err != nil {
+		return problem.BadRequest("Invalid as_of")
+	}
+
+	c.SetUserContext(store.WithAsOf(c.UserContext(), t))
+
+	return c.Next()
+}
@@ -12,16 +12,18 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/fiber/v2/utils"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/store"
 )
 
 func JWTAuth(c *fiber.Ctx) error {
 	// Get the JWT token from the Authorization header
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"msg": "Missing Authorization header",
-		})
+		return problem.Unauthorized("Missing Authorization header")
 	}
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
@@ -80,33 +82,34 @@ func JWTAuth(c *fiber.Ctx) error {
 	const invalidMsg = "Invalid token"
 
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"msg": invalidMsg,
-		})
+		return problem.Unauthorized(invalidMsg)
 	}
 
 	if !token.Valid {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"msg": invalidMsg,
-		})
+		return problem.Unauthorized(invalidMsg)
 	}
 
 	claims := token.Claims.(jwt.MapClaims)
 	audience, err := claims.GetAudience()
 
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"msg": invalidMsg,
-		})
+		return problem.Unauthorized(invalidMsg)
 	}
 
 	if contains(audience, "https://me-api.fly.dev/api") {
+		// Attribute any changes made by the request to the token's subject.
+		// The request ID may be a client header, which Fiber reuses after
+		// the request, so it is copied.
+		subject, _ := claims.GetSubject()
+		requestID, _ := c.Locals(requestid.ConfigDefault.ContextKey).(string)
+		requestID = utils.CopyString(requestID)
+
+		c.SetUserContext(store.WithActor(c.UserContext(), store.Actor{Subject: subject, RequestID: requestID}))
+
 		// Call the next middleware function
 		return c.Next()
 	} else {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"msg": invalidMsg,
-		})
+		return problem.Unauthorized(invalidMsg)
 	}
 }
 
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BaseURLKey is the key of the base URL stored in the request locals
+const BaseURLKey = "baseURL"
+
+// BaseURL stores the base URL that links in responses should use. If
+// configured is empty it is worked out from the request, taking the
+// Forwarded and X-Forwarded-* headers into account only when the request
+// comes from a trusted proxy, as set by the app's TrustedProxies.
+func BaseURL(configured string) fiber.Handler {
+	configured = strings.TrimSuffix(configured, "/")
+
+	return func(c *fiber.Ctx) error {
+		if configured != "" {
+			c.Locals(BaseURLKey, configured)
+		} else {
+			c.Locals(BaseURLKey, requestBaseURL(c))
+		}
+
+		return c.Next()
+	}
+}
+
+// requestBaseURL returns the scheme and host the client used to reach the API
+func requestBaseURL(c *fiber.Ctx) string {
+	// Fiber already handles X-Forwarded-Proto and X-Forwarded-Host, and
+	// ignores them unless the proxy is trusted
+	scheme := c.Protocol()
+	host := c.Hostname()
+
+	if !c.IsProxyTrusted() {
+		return scheme + "://" + host
+	}
+
+	// Prefer the standard Forwarded header, using the first proxy's values
+	if forwarded := c.Get(fiber.HeaderForwarded); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+
+		for _, pair := range strings.Split(first, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+
+			if !ok {
+				continue
+			}
+
+			value = strings.Trim(value, "\"")
+
+			switch strings.ToLower(key) {
+			case "proto":
+				scheme = value
+			case "host":
+				host = value
+			}
+		}
+	}
+
+	return scheme + "://" + host
+}
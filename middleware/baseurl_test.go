@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		trusted    []string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "configured",
+			configured: "https://me-api.fly.dev/",
+			headers:    map[string]string{fiber.HeaderXForwardedHost: "evil.example"},
+			want:       "https://me-api.fly.dev",
+		},
+		{
+			name: "request",
+			want: "http://example.com",
+		},
+		{
+			name:    "untrusted forwarded headers",
+			headers: map[string]string{fiber.HeaderXForwardedHost: "evil.example", fiber.HeaderXForwardedProto: "https", fiber.HeaderForwarded: "host=evil.example"},
+			want:    "http://example.com",
+		},
+		{
+			name:    "trusted x-forwarded headers",
+			trusted: []string{"0.0.0.0"},
+			headers: map[string]string{fiber.HeaderXForwardedHost: "api.example", fiber.HeaderXForwardedProto: "https"},
+			want:    "https://api.example",
+		},
+		{
+			name:    "trusted forwarded header",
+			trusted: []string{"0.0.0.0/8"},
+			headers: map[string]string{fiber.HeaderForwarded: "proto=https;host=\"api.example\", host=other.example"},
+			want:    "https://api.example",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{EnableTrustedProxyCheck: true, TrustedProxies: test.trusted})
+			app.Use(BaseURL(test.configured))
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(c.Locals(BaseURLKey).(string))
+			})
+
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+
+			for key, value := range test.headers {
+				req.Header.Set(key, value)
+			}
+
+			resp, err := app.Test(req)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body, _ := io.ReadAll(resp.Body)
+
+			if got := string(body); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultCacheControl is used by Conditional when no Cache-Control is configured
+const DefaultCacheControl = "public, max-age=60"
+
+// Conditional adds caching headers to successful GET responses and answers
+// conditional requests with 304 Not Modified. Responses get the configured
+// Cache-Control and an ETag, which is a weak hash of the body unless the
+// handler already set one. Handlers can also set Last-Modified, from when
+// the records they serve last changed, to answer If-Modified-Since. Requests
+// with credentials aren't publicly cacheable, so they are marked private
+// instead.
+func Conditional(cacheControl string) fiber.Handler {
+	if cacheControl == "" {
+		cacheControl = DefaultCacheControl
+	}
+
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		if (c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead) ||
+			c.Response().StatusCode() != fiber.StatusOK {
+			return nil
+		}
+
+		if c.Get(fiber.HeaderAuthorization) != "" {
+			c.Set(fiber.HeaderCacheControl, "private, no-cache")
+		} else {
+			c.Set(fiber.HeaderCacheControl, cacheControl)
+		}
+
+		etag := string(c.Response().Header.Peek(fiber.HeaderETag))
+
+		if etag == "" {
+			sum := sha256.Sum256(c.Response().Body())
+			etag = fmt.Sprintf("W/\"%x\"", sum[:12])
+			c.Set(fiber.HeaderETag, etag)
+		}
+
+		modified, ok := lastModified(c)
+
+		if !ok {
+			c.Response().Header.Del(fiber.HeaderLastModified)
+		}
+
+		if notModified(c, etag, modified) {
+			c.Status(fiber.StatusNotModified)
+			c.Response().ResetBody()
+		}
+
+		return nil
+	}
+}
+
+// lastModified returns the Last-Modified time set by the handler. It isn't
+// usable when it is in the current second, as HTTP dates have no fractions
+// and another change could still be made within that second.
+func lastModified(c *fiber.Ctx) (time.Time, bool) {
+	header := c.Response().Header.Peek(fiber.HeaderLastModified)
+
+	if len(header) == 0 {
+		return time.Time{}, false
+	}
+
+	t, err := http.ParseTime(string(header))
+
+	if err != nil || !t.Before(time.Now().Truncate(time.Second)) {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// notModified evaluates If-None-Match and If-Modified-Since. If-Modified-Since
+// is ignored when If-None-Match is sent, as ETags are more precise, or when
+// there is no Last-Modified time.
+func notModified(c *fiber.Ctx, etag string, lastModified time.Time) bool {
+	if header := c.Get(fiber.HeaderIfNoneMatch); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+
+			// If-None-Match uses a weak comparison
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if header := c.Get(fiber.HeaderIfModifiedSince); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+
+		return err == nil && !lastModified.After(since)
+	}
+
+	return false
+}
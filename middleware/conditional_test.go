@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func get(t *testing.T, app *fiber.App, headers map[string]string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/", nil)
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := app.Test(req)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+// TestConditional checks that validators follow the body, so a change made
+// within the same second as an earlier response isn't answered with a 304
+func TestConditional(t *testing.T) {
+	body := "first"
+
+	app := fiber.New()
+	app.Use(Conditional(""))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(body)
+	})
+
+	first := get(t, app, nil)
+	etag := first.Header.Get(fiber.HeaderETag)
+
+	if etag == "" || first.Header.Get(fiber.HeaderLastModified) != "" {
+		t.Fatalf("got ETag %q and Last-Modified %q", etag, first.Header.Get(fiber.HeaderLastModified))
+	}
+
+	if resp := get(t, app, map[string]string{fiber.HeaderIfNoneMatch: etag}); resp.StatusCode != fiber.StatusNotModified {
+		t.Errorf("matching If-None-Match gave %d", resp.StatusCode)
+	}
+
+	body = "second"
+
+	if resp := get(t, app, map[string]string{fiber.HeaderIfNoneMatch: etag}); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("stale If-None-Match gave %d", resp.StatusCode)
+	}
+
+	// Without a Last-Modified time there is nothing to compare it with
+	since := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+
+	if resp := get(t, app, map[string]string{fiber.HeaderIfModifiedSince: since}); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("If-Modified-Since gave %d", resp.StatusCode)
+	}
+}
+
+func TestConditionalIfModifiedSince(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name         string
+		lastModified time.Time
+		headers      map[string]string
+		status       int
+		sent         bool
+	}{
+		{
+			name:         "unchanged",
+			lastModified: hourAgo,
+			headers:      map[string]string{fiber.HeaderIfModifiedSince: hourAgo.Format(http.TimeFormat)},
+			status:       fiber.StatusNotModified,
+			sent:         true,
+		},
+		{
+			name:         "changed since",
+			lastModified: hourAgo,
+			headers:      map[string]string{fiber.HeaderIfModifiedSince: hourAgo.Add(-time.Second).Format(http.TimeFormat)},
+			status:       fiber.StatusOK,
+			sent:         true,
+		},
+		{
+			name:         "invalid date",
+			lastModified: hourAgo,
+			headers:      map[string]string{fiber.HeaderIfModifiedSince: "yesterday"},
+			status:       fiber.StatusOK,
+			sent:         true,
+		},
+		{
+			name:         "If-None-Match takes precedence",
+			lastModified: hourAgo,
+			headers: map[string]string{
+				fiber.HeaderIfModifiedSince: hourAgo.Format(http.TimeFormat),
+				fiber.HeaderIfNoneMatch:     `"other"`,
+			},
+			status: fiber.StatusOK,
+			sent:   true,
+		},
+		{
+			// Another change could still be made within the same second
+			name:         "changed this second",
+			lastModified: time.Now(),
+			headers:      map[string]string{fiber.HeaderIfModifiedSince: time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)},
+			status:       fiber.StatusOK,
+			sent:         false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(Conditional(""))
+			app.Get("/", func(c *fiber.Ctx) error {
+				c.Set(fiber.HeaderLastModified, test.lastModified.UTC().Format(http.TimeFormat))
+				return c.SendString("body")
+			})
+
+			resp := get(t, app, test.headers)
+
+			if resp.StatusCode != test.status {
+				t.Errorf("got status %d, want %d", resp.StatusCode, test.status)
+			}
+
+			if sent := resp.Header.Get(fiber.HeaderLastModified) != ""; sent != test.sent {
+				t.Errorf("got Last-Modified %q", resp.Header.Get(fiber.HeaderLastModified))
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry records a single change made to a character, species or gender
+type AuditEntry struct {
+	ID   int       `json:"id"`
+	Time time.Time `json:"time"`
+
+	// Actor is the subject of the token the change was made with
+	Actor     string `json:"actor"`
+	RequestID string `json:"request_id"`
+
+	// Action is one of create, update, delete or restore
+	Action     string `json:"action"`
+	Resource   string `json:"resource"`
+	ResourceID int    `json:"resource_id"`
+	URL        string `json:"url"`
+
+	// Before and After are the record either side of the change, or null
+	// when it didn't exist or was deleted. Changes is a JSON Patch from
+	// Before to After, set when both are.
+	Before  json.RawMessage `json:"before"`
+	After   json.RawMessage `json:"after"`
+	Changes json.RawMessage `json:"changes"`
+}
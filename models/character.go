@@ -1,11 +1,17 @@
 package models
 
+import "time"
+
+// Character is the form characters are written in. Species and Gender are 0
+// when the character has none, such as after its species or gender was
+// deleted with references=nullify.
 type Character struct {
 	ID      int    `json:"id"`
-	Name    string `json:"name"`
-	Species int    `json:"species"`
-	Gender  int    `json:"gender"`
-	Class   string `json:"class"`
+	Name    string `json:"name" validate:"required,max=255"`
+	Species int    `json:"species" validate:"min=0"`
+	Gender  int    `json:"gender" validate:"min=0"`
+	Class   string `json:"class" validate:"max=255"`
+	URL     string `json:"url"`
 }
 
 type CharacterObject struct {
@@ -14,4 +20,35 @@ type CharacterObject struct {
 	Species *SpeciesObject `json:"species"`
 	Gender  *GenderObject  `json:"gender"`
 	Class   string         `json:"class"`
+	URL     string         `json:"url"`
+
+	// DeletedAt is set once the character has been deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// SpeciesID returns the ID of the character's species, or 0 if it has none
+func (c *CharacterObject) SpeciesID() int {
+	if c.Species == nil {
+		return 0
+	}
+
+	return c.Species.ID
+}
+
+// GenderID returns the ID of the character's gender, or 0 if it has none
+func (c *CharacterObject) GenderID() int {
+	if c.Gender == nil {
+		return 0
+	}
+
+	return c.Gender.ID
+}
+
+// Matches reports whether the character already has the name, species,
+// gender and class of character, so that writing it would change nothing
+func (c *CharacterObject) Matches(character Character) bool {
+	return c.Name == character.Name &&
+		c.Class == character.Class &&
+		c.SpeciesID() == character.Species &&
+		c.GenderID() == character.Gender
 }
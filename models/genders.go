@@ -1,12 +1,34 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Gender struct {
 	ID   int    `json:"id"`
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=255"`
+	URL  string `json:"url"`
+
+	// DeletedAt is set once the gender has been deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type GenderObject struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
 	URL  string `json:"url"`
+
+	// LinkOnly renders the gender as just its URL instead of an object
+	LinkOnly bool `json:"-"`
+}
+
+func (g GenderObject) MarshalJSON() ([]byte, error) {
+	if g.LinkOnly {
+		return json.Marshal(g.URL)
+	}
+
+	// Use a type without this method to get the default encoding
+	type object GenderObject
+	return json.Marshal(object(g))
 }
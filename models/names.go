@@ -0,0 +1,10 @@
+package models
+
+import "strings"
+
+// NameKey returns the key records are matched by when they are looked up by
+// name, as the importer and the seed do, so that names differing only in
+// case refer to the same record
+func NameKey(name string) string {
+	return strings.ToLower(name)
+}
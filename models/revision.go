@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Revision is the state of a character, species or gender after a change.
+// Revisions of a record are numbered from 1.
+type Revision struct {
+	Revision int       `json:"revision"`
+	Time     time.Time `json:"time"`
+
+	// Action is the change that made the revision, as in the audit log
+	Action string `json:"action"`
+
+	// Record is the record in the form it is written in. When Deleted is
+	// set it is the record as it was when it was deleted.
+	Record  json.RawMessage `json:"record"`
+	Deleted bool            `json:"deleted"`
+
+	Resource   string `json:"-"`
+	ResourceID int    `json:"-"`
+	URL        string `json:"url"`
+}
@@ -1,12 +1,34 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Species struct {
 	ID   int    `json:"id"`
-	Name string `json:"name"`
+	Name string `json:"name" validate:"required,max=255"`
+	URL  string `json:"url"`
+
+	// DeletedAt is set once the species has been deleted
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
 type SpeciesObject struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
 	URL  string `json:"url"`
+
+	// LinkOnly renders the species as just its URL instead of an object
+	LinkOnly bool `json:"-"`
+}
+
+func (s SpeciesObject) MarshalJSON() ([]byte, error) {
+	if s.LinkOnly {
+		return json.Marshal(s.URL)
+	}
+
+	// Use a type without this method to get the default encoding
+	type object SpeciesObject
+	return json.Marshal(object(s))
 }
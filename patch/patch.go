@@ -0,0 +1,544 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types of the supported patch formats
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrTestFailed is returned when a JSON Patch test operation doesn't match
+// the document, meaning it has changed since the client last read it
+var ErrTestFailed = errors.New("test operation failed")
+
+// Merge applies an RFC 7396 JSON Merge Patch to a JSON document. Members of
+// the patch replace those of the document, and null members remove them.
+func Merge(document, patch []byte) ([]byte, error) {
+	target, err := decode(document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := decode(patch)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target, patch any) any {
+	changes, ok := patch.(map[string]any)
+
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]any)
+
+	if !ok {
+		object = map[string]any{}
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(object, key)
+		} else {
+			object[key] = merge(object[key], value)
+		}
+	}
+
+	return object
+}
+
+// Apply applies an RFC 6902 JSON Patch to a JSON document. The operations
+// are applied in order and the patch fails as a whole if any of them does.
+func Apply(document, patch []byte) ([]byte, error) {
+	target, err := decode(document)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []map[string]json.RawMessage
+
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&operations); err != nil {
+		return nil, errors.New("patch must be an array of operations")
+	}
+
+	for i, operation := range operations {
+		target, err = applyOperation(target, operation)
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(document any, operation map[string]json.RawMessage) (any, error) {
+	op, err := stringMember(operation, "op")
+
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := pointerMember(operation, "path")
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "add", "replace", "test":
+		raw, ok := operation["value"]
+
+		if !ok {
+			return nil, errors.New("missing value")
+		}
+
+		value, err := decode(raw)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case "add":
+			return add(document, path, value)
+		case "replace":
+			return replace(document, path, value)
+		default:
+			current, err := get(document, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !equal(current, value) {
+				return nil, ErrTestFailed
+			}
+
+			return document, nil
+		}
+	case "remove":
+		return remove(document, path)
+	case "move", "copy":
+		from, err := pointerMember(operation, "from")
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(document, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if op == "copy" {
+			return add(document, path, copyValue(value))
+		}
+
+		if len(path) > len(from) && equalTokens(path[:len(from)], from) {
+			return nil, errors.New("can't move a value into one of its children")
+		}
+
+		document, err = remove(document, from)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return add(document, path, value)
+	default:
+		return nil, fmt.Errorf("unknown op %q", op)
+	}
+}
+
+func stringMember(operation map[string]json.RawMessage, name string) (string, error) {
+	var value string
+
+	raw, ok := operation[name]
+
+	if !ok {
+		return "", fmt.Errorf("missing %s", name)
+	}
+
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("%s must be a string", name)
+	}
+
+	return value, nil
+}
+
+func pointerMember(operation map[string]json.RawMessage, name string) ([]string, error) {
+	value, err := stringMember(operation, name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePointer(value)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer such as "/species/name" into
+// its reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens, nil
+}
+
+func get(document any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := document.(type) {
+		case map[string]any:
+			value, ok := node[token]
+
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", token)
+			}
+
+			document = value
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			document = node[i]
+		default:
+			return nil, fmt.Errorf("path %s does not exist", token)
+		}
+	}
+
+	return document, nil
+}
+
+func add(document any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modify(document, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			if token == "-" {
+				return append(node, value), nil
+			}
+
+			i, err := arrayIndex(token, len(node))
+
+			if err != nil {
+				return nil, err
+			}
+
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("can't add %s to a value that isn't an object or array", token)
+		}
+	})
+}
+
+func remove(document any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("can't remove the whole document")
+	}
+
+	return modify(document, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("path %s does not exist", token)
+			}
+
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("path %s does not exist", token)
+		}
+	})
+}
+
+func replace(document any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modify(document, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("path %s does not exist", token)
+			}
+
+			node[token] = value
+			return node, nil
+		case []any:
+			i, err := arrayIndex(token, len(node)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			node[i] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("path %s does not exist", token)
+		}
+	})
+}
+
+// modify walks to the parent of the value at path and calls change with it
+// and the last token. change returns the updated parent, which replaces the
+// original as arrays can't be resized in place.
+func modify(document any, path []string, change func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return change(document, path[0])
+	}
+
+	child, err := get(document, path[:1])
+
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = modify(child, path[1:], change)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := document.(type) {
+	case map[string]any:
+		node[path[0]] = child
+	case []any:
+		i, _ := arrayIndex(path[0], len(node)-1)
+		node[i] = child
+	}
+
+	return document, nil
+}
+
+// arrayIndex parses an array index token, which can be at most last
+func arrayIndex(token string, last int) (int, error) {
+	i, err := strconv.Atoi(token)
+
+	if err != nil || i < 0 || i > last || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %s", token)
+	}
+
+	return i, nil
+}
+
+func equalTokens(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// equal compares two decoded JSON values, treating numbers as equal when
+// they have the same value, e.g. 1 and 1.0
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for key, value := range a {
+			other, ok := b[key]
+
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []any:
+		b, ok := b.([]any)
+
+		if !ok || len(a) != len(b) {
+			return false
+		}
+
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+
+		return true
+	case json.Number:
+		b, ok := b.(json.Number)
+
+		if !ok {
+			return false
+		}
+
+		x, okA := new(big.Rat).SetString(a.String())
+		y, okB := new(big.Rat).SetString(b.String())
+
+		return okA && okB && x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+func copyValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		object := make(map[string]any, len(value))
+
+		for key, child := range value {
+			object[key] = copyValue(child)
+		}
+
+		return object
+	case []any:
+		array := make([]any, len(value))
+
+		for i, child := range value {
+			array[i] = copyValue(child)
+		}
+
+		return array
+	default:
+		return value
+	}
+}
+
+// decode parses JSON keeping numbers exact, so they aren't changed by
+// round tripping through float64
+func decode(data []byte) (any, error) {
+	var value any
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// Diff returns an RFC 6902 JSON Patch that turns original into modified.
+// Objects are compared member by member, any other value that differs,
+// including arrays, is replaced as a whole.
+func Diff(original, modified []byte) ([]byte, error) {
+	before, err := decode(original)
+
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := decode(modified)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(diff("", before, after, []map[string]any{}))
+}
+
+func diff(pointer string, before, after any, operations []map[string]any) []map[string]any {
+	beforeObject, isObject := before.(map[string]any)
+	afterObject, bothObjects := after.(map[string]any)
+
+	if !isObject || !bothObjects {
+		if !equal(before, after) {
+			operations = append(operations, map[string]any{"op": "replace", "path": pointer, "value": after})
+		}
+
+		return operations
+	}
+
+	for _, key := range sortedKeys(beforeObject) {
+		if _, ok := afterObject[key]; !ok {
+			operations = append(operations, map[string]any{"op": "remove", "path": pointer + "/" + escapeToken(key)})
+		}
+	}
+
+	for _, key := range sortedKeys(afterObject) {
+		path := pointer + "/" + escapeToken(key)
+
+		if value, ok := beforeObject[key]; ok {
+			operations = diff(path, value, afterObject[key], operations)
+		} else {
+			operations = append(operations, map[string]any{"op": "add", "path": path, "value": afterObject[key]})
+		}
+	}
+
+	return operations
+}
+
+// escapeToken escapes a member name for use in a JSON Pointer
+func escapeToken(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+func sortedKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+
+	for key := range object {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
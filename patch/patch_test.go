@@ -0,0 +1,200 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// assertJSON fails unless got and want encode the same JSON value
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var gotValue, wantValue any
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("invalid result %s - %v", got, err)
+	}
+
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatalf("invalid expectation %s - %v", want, err)
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// The examples from RFC 7396 appendix A
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		document, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		got, err := Merge([]byte(test.document), []byte(test.patch))
+
+		if err != nil {
+			t.Errorf("Merge(%s, %s) failed - %v", test.document, test.patch, err)
+			continue
+		}
+
+		assertJSON(t, got, test.want)
+	}
+}
+
+func TestMergeInvalid(t *testing.T) {
+	if _, err := Merge([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Error("expected an error for an invalid patch")
+	}
+
+	if _, err := Merge([]byte(`{`), []byte(`{}`)); err == nil {
+		t.Error("expected an error for an invalid document")
+	}
+}
+
+// The examples from RFC 6902 appendix A, and a few more edge cases
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name, document, patch, want string
+	}{
+		{"add object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"remove object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"test value", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"add nested member", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{"ignore unrecognized members", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"foo":"bar","baz":"qux"}`},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{"add array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"copy value", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"replace whole document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"add null value", `{"a":1}`, `[{"op":"add","path":"/b","value":null}]`, `{"a":1,"b":null}`},
+		{"test equal objects", `{"a":{"x":1,"y":[1,2]}}`, `[{"op":"test","path":"/a","value":{"y":[1,2],"x":1.0}}]`, `{"a":{"x":1,"y":[1,2]}}`},
+		{"no operations", `{"a":1}`, `[]`, `{"a":1}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Apply([]byte(test.document), []byte(test.patch))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSON(t, got, test.want)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name, document, patch string
+		testFailed            bool
+	}{
+		{"test mismatch", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, true},
+		{"test string against number", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, true},
+		{"test missing member", `{}`, `[{"op":"test","path":"/a","value":null}]`, false},
+		{"add to missing parent", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, false},
+		{"duplicate op member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","op":"remove"}]`, false},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, false},
+		{"replace missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":1}]`, false},
+		{"array index out of range", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, false},
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, false},
+		{"remove end of array", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, false},
+		{"move into own child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, false},
+		{"unknown op", `{}`, `[{"op":"frobnicate","path":"/a"}]`, false},
+		{"missing path", `{}`, `[{"op":"add","value":1}]`, false},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, false},
+		{"invalid pointer", `{}`, `[{"op":"add","path":"a","value":1}]`, false},
+		{"not an array", `{}`, `{"op":"add","path":"/a","value":1}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Apply([]byte(test.document), []byte(test.patch))
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if errors.Is(err, ErrTestFailed) != test.testFailed {
+				t.Errorf("got %v, want test failure %v", err, test.testFailed)
+			}
+		})
+	}
+}
+
+// TestLargeNumbers checks that numbers keep their precision through a patch
+func TestLargeNumbers(t *testing.T) {
+	document := []byte(`{"n":12345678901234567890}`)
+
+	merged, err := Merge(document, []byte(`{"m":1}`))
+
+	if err != nil || !strings.Contains(string(merged), "12345678901234567890") {
+		t.Errorf("Merge gave %s, %v", merged, err)
+	}
+
+	applied, err := Apply(document, []byte(`[{"op":"copy","from":"/n","path":"/m"}]`))
+
+	if err != nil || strings.Count(string(applied), "12345678901234567890") != 2 {
+		t.Errorf("Apply gave %s, %v", applied, err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name, original, modified, want string
+	}{
+		{"unchanged", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1.0}`, `[]`},
+		{"replace member", `{"a":1,"b":2}`, `{"a":1,"b":3}`, `[{"op":"replace","path":"/b","value":3}]`},
+		{"add and remove", `{"a":1}`, `{"b":2}`, `[{"op":"remove","path":"/a"},{"op":"add","path":"/b","value":2}]`},
+		{"nested objects", `{"a":{"b":1,"c":2}}`, `{"a":{"b":1,"c":3}}`, `[{"op":"replace","path":"/a/c","value":3}]`},
+		{"arrays are replaced", `{"a":[1,2]}`, `{"a":[1]}`, `[{"op":"replace","path":"/a","value":[1]}]`},
+		{"escaped names", `{"a/b":1,"c~d":1}`, `{"a/b":2}`, `[{"op":"remove","path":"/c~0d"},{"op":"replace","path":"/a~1b","value":2}]`},
+		{"null values", `{"a":null}`, `{"a":1}`, `[{"op":"replace","path":"/a","value":1}]`},
+		{"whole document", `{"a":1}`, `[1]`, `[{"op":"replace","path":"","value":[1]}]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := Diff([]byte(test.original), []byte(test.modified))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSON(t, got, test.want)
+
+			// Applying the diff must give back the modified document
+			patched, err := Apply([]byte(test.original), got)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertJSON(t, patched, test.modified)
+		})
+	}
+}
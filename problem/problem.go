@@ -0,0 +1,176 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/validation"
+)
+
+// ContentType is the media type of problem details responses
+const ContentType = "application/problem+json"
+
+// Problem types. These are stable identifiers that clients can branch on.
+const (
+	TypeBadRequest      = "/problems/bad-request"
+	TypeUnauthorized    = "/problems/unauthorized"
+	TypeNotFound        = "/problems/not-found"
+	TypeConflict        = "/problems/conflict"
+	TypePrecondition    = "/problems/precondition-failed"
+	TypeUnsupportedType = "/problems/unsupported-media-type"
+	TypeValidation      = "/problems/validation"
+	TypeTooManyRequests = "/problems/too-many-requests"
+	TypeInternal        = "/problems/internal"
+	TypeUnavailable     = "/problems/unavailable"
+)
+
+// Problem is an error rendered as an RFC 7807 problem details response
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Errors lists the invalid fields of a validation problem
+	Errors []validation.FieldError `json:"errors,omitempty"`
+
+	// References links to the resources that a conflicting change would break
+	References []string `json:"references,omitempty"`
+
+	// cause is the underlying error, which is logged but never sent to clients
+	cause error
+}
+
+func (p *Problem) Error() string {
+	if p.cause != nil {
+		return fmt.Sprintf("%s: %s", p.Title, p.cause.Error())
+	}
+
+	if p.Detail != "" {
+		return fmt.Sprintf("%s: %s", p.Title, p.Detail)
+	}
+
+	return p.Title
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// New creates a problem with the standard title for the status
+func New(status int, problemType string, detail string) *Problem {
+	return &Problem{
+		Type:   problemType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func BadRequest(detail string) *Problem {
+	return New(fiber.StatusBadRequest, TypeBadRequest, detail)
+}
+
+func Unauthorized(detail string) *Problem {
+	return New(fiber.StatusUnauthorized, TypeUnauthorized, detail)
+}
+
+func NotFound(detail string) *Problem {
+	return New(fiber.StatusNotFound, TypeNotFound, detail)
+}
+
+// Conflict reports that the request conflicts with the current state of the resource
+func Conflict(detail string) *Problem {
+	return New(fiber.StatusConflict, TypeConflict, detail)
+}
+
+// PreconditionFailed reports that a conditional request, such as one with
+// If-Match, doesn't match the current version of the resource
+func PreconditionFailed(detail string) *Problem {
+	return New(fiber.StatusPreconditionFailed, TypePrecondition, detail)
+}
+
+func UnsupportedMediaType(detail string) *Problem {
+	return New(fiber.StatusUnsupportedMediaType, TypeUnsupportedType, detail)
+}
+
+// Validation reports the fields or parameters of a request that are invalid
+func Validation(fieldErrors []validation.FieldError) *Problem {
+	p := New(fiber.StatusUnprocessableEntity, TypeValidation, "The request has invalid fields")
+	p.Errors = fieldErrors
+	return p
+}
+
+func TooManyRequests() *Problem {
+	return New(fiber.StatusTooManyRequests, TypeTooManyRequests, "Too many requests, please try again later")
+}
+
+// Internal hides an unexpected error from the client behind a generic problem
+func Internal(cause error) *Problem {
+	p := New(fiber.StatusInternalServerError, TypeInternal, "")
+	p.cause = cause
+	return p
+}
+
+// Unavailable reports that a dependency such as the database couldn't be
+// reached, so the request may succeed if retried later
+func Unavailable(cause error) *Problem {
+	p := New(fiber.StatusServiceUnavailable, TypeUnavailable, "The service is temporarily unavailable, please try again later")
+	p.cause = cause
+	return p
+}
+
+// Handler is a fiber.ErrorHandler that renders every error returned by a
+// handler as problem details. Errors that aren't a Problem or a fiber.Error
+// are treated as internal errors.
+func Handler(c *fiber.Ctx, err error) error {
+	var p *Problem
+
+	if !errors.As(err, &p) {
+		var fiberError *fiber.Error
+
+		if errors.As(err, &fiberError) {
+			p = fromStatus(fiberError.Code, fiberError.Message)
+		} else {
+			p = Internal(err)
+		}
+	}
+
+	if p.cause != nil {
+		fmt.Printf("Error - \"%s\" for the following request:\n", p.cause.Error())
+	}
+
+	response := *p
+	response.Instance = c.OriginalURL()
+
+	body, err := json.Marshal(response)
+
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, ContentType)
+	return c.Status(response.Status).Send(body)
+}
+
+// fromStatus converts errors raised by Fiber itself, such as unknown routes
+func fromStatus(status int, detail string) *Problem {
+	switch status {
+	case fiber.StatusBadRequest:
+		return BadRequest(detail)
+	case fiber.StatusNotFound:
+		return NotFound(detail)
+	case fiber.StatusTooManyRequests:
+		return TooManyRequests()
+	}
+
+	if status >= fiber.StatusInternalServerError {
+		return Internal(errors.New(detail))
+	}
+
+	return New(status, "about:blank", detail)
+}
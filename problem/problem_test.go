@@ -0,0 +1,149 @@
+package problem_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/njwong/me-api/problem"
+	"github.com/njwong/me-api/validation"
+)
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want map[string]any
+	}{
+		{
+			name: "problem",
+			err:  problem.NotFound("Character not found"),
+			want: map[string]any{
+				"type":     problem.TypeNotFound,
+				"title":    "Not Found",
+				"status":   404.0,
+				"detail":   "Character not found",
+				"instance": "/fail?id=1",
+			},
+		},
+		{
+			name: "wrapped problem",
+			err:  fmt.Errorf("saving - %w", problem.Conflict("Name is taken")),
+			want: map[string]any{
+				"type":     problem.TypeConflict,
+				"title":    "Conflict",
+				"status":   409.0,
+				"detail":   "Name is taken",
+				"instance": "/fail?id=1",
+			},
+		},
+		{
+			name: "validation",
+			err:  problem.Validation([]validation.FieldError{{Field: "name", Message: "is required"}}),
+			want: map[string]any{
+				"type":     problem.TypeValidation,
+				"title":    "Unprocessable Entity",
+				"status":   422.0,
+				"detail":   "The request has invalid fields",
+				"instance": "/fail?id=1",
+				"errors":   []any{map[string]any{"field": "name", "message": "is required"}},
+			},
+		},
+		{
+			name: "fiber error",
+			err:  fiber.ErrMethodNotAllowed,
+			want: map[string]any{
+				"type":     "about:blank",
+				"title":    "Method Not Allowed",
+				"status":   405.0,
+				"detail":   "Method Not Allowed",
+				"instance": "/fail?id=1",
+			},
+		},
+		{
+			// The cause could leak details of the database, so it isn't sent
+			name: "other error",
+			err:  errors.New("connection to 10.0.0.1 refused"),
+			want: map[string]any{
+				"type":     problem.TypeInternal,
+				"title":    "Internal Server Error",
+				"status":   500.0,
+				"instance": "/fail?id=1",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+			app.Get("/fail", func(c *fiber.Ctx) error {
+				return test.err
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/fail?id=1", nil))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != int(test.want["status"].(float64)) {
+				t.Errorf("got status %d", resp.StatusCode)
+			}
+
+			if contentType := resp.Header.Get(fiber.HeaderContentType); contentType != problem.ContentType {
+				t.Errorf("got content type %q", contentType)
+			}
+
+			data, err := io.ReadAll(resp.Body)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body map[string]any
+
+			if err := json.Unmarshal(data, &body); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(body, test.want) {
+				t.Errorf("got %s", data)
+			}
+		})
+	}
+}
+
+func TestHandlerUnknownRoute(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.Handler})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/missing", nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != fiber.StatusNotFound || !strings.Contains(string(data), problem.TypeNotFound) {
+		t.Errorf("got %d: %s", resp.StatusCode, data)
+	}
+}
+
+func TestError(t *testing.T) {
+	cause := errors.New("disk full")
+	p := problem.Internal(cause)
+
+	if !errors.Is(p, cause) || !strings.Contains(p.Error(), "disk full") {
+		t.Errorf("internal problem %q doesn't wrap its cause", p.Error())
+	}
+
+	if got := problem.BadRequest("Invalid limit").Error(); got != "Bad Request: Invalid limit" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token scores, from best to worst kind of match
+const (
+	exactScore     = 1.0
+	prefixScore    = 0.9
+	typoScore      = 0.8
+	substringScore = 0.6
+)
+
+// tokenize lowercases text and splits it into words, so that e.g.
+// "Tali'Zorah" can be found by searching for "zorah"
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// scoreDocument scores how well a document's tokens match the query tokens,
+// from 0 (no match) to 1. Every query token has to match some token in the
+// document, and the score is the average of their best matches.
+func scoreDocument(queryTokens, documentTokens []string) float64 {
+	total := 0.0
+
+	for _, queryToken := range queryTokens {
+		best := 0.0
+
+		for _, documentToken := range documentTokens {
+			if score := scoreToken(queryToken, documentToken); score > best {
+				best = score
+			}
+		}
+
+		if best == 0 {
+			return 0
+		}
+
+		total += best
+	}
+
+	return total / float64(len(queryTokens))
+}
+
+// scoreToken scores how well a single query token matches a document token
+func scoreToken(query, token string) float64 {
+	if query == token {
+		return exactScore
+	}
+
+	if strings.HasPrefix(token, query) {
+		return prefixScore
+	}
+
+	allowed := allowedTypos(query)
+
+	if allowed > 0 {
+		distance := editDistance(query, token)
+
+		// Also allow typos in a prefix of the token, e.g. "vakaran" for "vakarian"
+		if len([]rune(token)) > len([]rune(query)) {
+			prefix := string([]rune(token)[:len([]rune(query))])
+
+			if prefixDistance := editDistance(query, prefix); prefixDistance < distance {
+				distance = prefixDistance
+			}
+		}
+
+		if distance <= allowed {
+			// Each typo costs a little so closer matches rank first
+			return typoScore - 0.1*float64(distance-1)
+		}
+	}
+
+	if len(query) >= 3 && strings.Contains(token, query) {
+		return substringScore
+	}
+
+	return 0
+}
+
+// allowedTypos returns how many edits a query token may differ by. Short
+// tokens need to match exactly or they would match almost anything.
+func allowedTypos(token string) int {
+	length := len([]rune(token))
+
+	switch {
+	case length >= 8:
+		return 2
+	case length >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and
+// transpositions of adjacent characters needed to turn a into b (the
+// optimal string alignment distance)
+func editDistance(a, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	// d[i][j] is the distance between the first i runes of a and the first j runes of b
+	d := make([][]int, len(ra)+1)
+
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(values ...int) int {
+	smallest := values[0]
+
+	for _, value := range values[1:] {
+		if value < smallest {
+			smallest = value
+		}
+	}
+
+	return smallest
+}
@@ -0,0 +1,180 @@
+package search
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/njwong/me-api/store"
+)
+
+// maxAge is how long the index is trusted before it is rebuilt, which picks
+// up changes made through other instances of the API
+const maxAge = 5 * time.Minute
+
+// Result is a single search match
+type Result struct {
+	// Resource is the store resource name, e.g. "characters"
+	Resource string
+	ID       int
+	Name     string
+	Score    float64
+}
+
+// document is a searchable record, with its name already tokenized
+type document struct {
+	resource string
+	id       int
+	name     string
+	tokens   []string
+}
+
+// Index is an in-memory search index over the names of every character,
+// species and gender. It is built from the store on first use and rebuilt
+// after Invalidate is called, so it behaves the same with every backend.
+type Index struct {
+	store *store.Store
+
+	mu        sync.RWMutex
+	documents []document
+	builtAt   time.Time
+	stale     bool
+}
+
+func NewIndex(s *store.Store) *Index {
+	return &Index{store: s, stale: true}
+}
+
+// Invalidate marks the index as out of date. It has the signature of a
+// store.WriteHook so it can be attached with store.WithWriteHook.
+func (index *Index) Invalidate(ctx context.Context, resource string, id int) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	index.stale = true
+}
+
+// Search returns up to limit records whose names match query, best first
+func (index *Index) Search(ctx context.Context, query string, limit int) ([]Result, error) {
+	documents, err := index.current(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queryTokens := tokenize(query)
+	results := []Result{}
+
+	if len(queryTokens) == 0 {
+		return results, nil
+	}
+
+	for _, doc := range documents {
+		score := scoreDocument(queryTokens, doc.tokens)
+
+		if score == 0 {
+			continue
+		}
+
+		results = append(results, Result{
+			Resource: doc.resource,
+			ID:       doc.id,
+			Name:     doc.name,
+			Score:    score,
+		})
+	}
+
+	// Prefer better scores, then shorter names as they match more of the query
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+
+		return len(results[i].Name) < len(results[j].Name)
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// current returns the indexed documents, rebuilding them first if needed
+func (index *Index) current(ctx context.Context) ([]document, error) {
+	index.mu.RLock()
+	fresh := !index.stale && time.Since(index.builtAt) < maxAge
+	documents := index.documents
+	index.mu.RUnlock()
+
+	if fresh {
+		return documents, nil
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	// Another request may have rebuilt the index while waiting for the lock
+	if !index.stale && time.Since(index.builtAt) < maxAge {
+		return index.documents, nil
+	}
+
+	documents, err := index.build(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index.documents = documents
+	index.builtAt = time.Now()
+	index.stale = false
+
+	return documents, nil
+}
+
+// build reads every record from the store into documents
+func (index *Index) build(ctx context.Context) ([]document, error) {
+	documents := []document{}
+
+	add := func(resource string, id int, name string) {
+		documents = append(documents, document{
+			resource: resource,
+			id:       id,
+			name:     name,
+			tokens:   tokenize(name),
+		})
+	}
+
+	characters, _, err := index.store.Characters.List(ctx, store.CharacterFilter{}, store.ListOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, character := range characters {
+		add(store.ResourceCharacters, character.ID, character.Name)
+	}
+
+	speciesList, _, err := index.store.Species.List(ctx, store.ListOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, species := range speciesList {
+		add(store.ResourceSpecies, species.ID, species.Name)
+	}
+
+	genders, _, err := index.store.Genders.List(ctx, store.ListOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gender := range genders {
+		add(store.ResourceGenders, gender.ID, gender.Name)
+	}
+
+	return documents, nil
+}
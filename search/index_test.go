@@ -0,0 +1,194 @@
+package search_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/search"
+	"github.com/njwong/me-api/store"
+)
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newStore creates a store with a few species, genders and characters
+func newStore(t *testing.T) *store.Store {
+	t.Helper()
+
+	ctx := context.Background()
+	s := store.NewMemory()
+
+	for _, name := range []string{"Turian", "Quarian", "Krogan"} {
+		mustDo(t, s.Species.Create(ctx, &models.Species{Name: name}))
+	}
+
+	for _, name := range []string{"Male", "Female"} {
+		mustDo(t, s.Genders.Create(ctx, &models.Gender{Name: name}))
+	}
+
+	for _, character := range []models.Character{
+		{Name: "Garrus Vakarian", Species: 1, Gender: 1},
+		{Name: "Tali'Zorah", Species: 2, Gender: 2},
+		{Name: "Grunt", Species: 3, Gender: 1},
+	} {
+		character := character
+		mustDo(t, s.Characters.Create(ctx, &character))
+	}
+
+	return s
+}
+
+// match is the part of a result the tests compare
+type match struct {
+	resource string
+	name     string
+}
+
+func TestSearch(t *testing.T) {
+	index := search.NewIndex(newStore(t))
+
+	tests := []struct {
+		name  string
+		query string
+		want  []match
+	}{
+		{"exact", "Grunt", []match{{store.ResourceCharacters, "Grunt"}}},
+		{"ignores case", "TURIAN", []match{{store.ResourceSpecies, "Turian"}}},
+		{"prefix", "kro", []match{{store.ResourceSpecies, "Krogan"}}},
+		{"typo", "garus", []match{{store.ResourceCharacters, "Garrus Vakarian"}}},
+		{"transposed letters", "gurnt", []match{{store.ResourceCharacters, "Grunt"}}},
+		{"typo in a prefix", "vakaran", []match{{store.ResourceCharacters, "Garrus Vakarian"}}},
+		{"word within a name", "zorah", []match{{store.ResourceCharacters, "Tali'Zorah"}}},
+		{"every word has to match", "garrus zorah", nil},
+		{"short words need to match exactly", "gru", []match{{store.ResourceCharacters, "Grunt"}}},
+		{"too many typos", "gxrxs", nil},
+		{"exact before substring", "male", []match{{store.ResourceGenders, "Male"}, {store.ResourceGenders, "Female"}}},
+		{"exact before typo", "quarian", []match{{store.ResourceSpecies, "Quarian"}}},
+		{"typo before substring", "turain", []match{{store.ResourceSpecies, "Turian"}}},
+		{"no words", "'-", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := index.Search(context.Background(), test.query, 0)
+			mustDo(t, err)
+
+			got := []match{}
+
+			for _, result := range results {
+				got = append(got, match{result.Resource, result.Name})
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("searching %q gave %v, want %v", test.query, got, test.want)
+			}
+
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("searching %q gave %v, want %v", test.query, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+// TestSearchScores checks that better matches score higher and that results
+// are ordered by score
+func TestSearchScores(t *testing.T) {
+	index := search.NewIndex(newStore(t))
+
+	for _, query := range []string{"grunt", "grun", "grnt", "gurnt", "male"} {
+		results, err := index.Search(context.Background(), query, 0)
+		mustDo(t, err)
+
+		if len(results) == 0 {
+			t.Fatalf("searching %q found nothing", query)
+		}
+
+		for i := 1; i < len(results); i++ {
+			if results[i].Score > results[i-1].Score {
+				t.Errorf("searching %q ranked %+v above %+v", query, results[i-1], results[i])
+			}
+		}
+	}
+
+	score := func(query string) float64 {
+		results, err := index.Search(context.Background(), query, 1)
+		mustDo(t, err)
+
+		return results[0].Score
+	}
+
+	if exact, prefix, typo := score("grunt"), score("grun"), score("grnt"); !(exact > prefix && prefix > typo) {
+		t.Errorf("got exact %v, prefix %v and typo %v", exact, prefix, typo)
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	index := search.NewIndex(newStore(t))
+
+	results, err := index.Search(context.Background(), "male", 1)
+	mustDo(t, err)
+
+	if len(results) != 1 || results[0].Name != "Male" {
+		t.Errorf("got %+v, want only the best match", results)
+	}
+}
+
+// TestSearchRebuild checks that writes through a store with the index's
+// write hook show up in the next search
+func TestSearchRebuild(t *testing.T) {
+	ctx := context.Background()
+	base := newStore(t)
+	index := search.NewIndex(base)
+	s := store.WithWriteHook(base, index.Invalidate)
+
+	find := func(query string) []search.Result {
+		t.Helper()
+
+		results, err := index.Search(ctx, query, 0)
+		mustDo(t, err)
+
+		return results
+	}
+
+	if results := find("liara"); len(results) != 0 {
+		t.Fatalf("found %+v before Liara was created", results)
+	}
+
+	liara := models.Character{Name: "Liara"}
+	mustDo(t, s.Characters.Create(ctx, &liara))
+
+	if results := find("liara"); len(results) != 1 || results[0].ID != liara.ID {
+		t.Fatalf("got %+v after creating Liara", results)
+	}
+
+	liara.Name = "Liara T'Soni"
+	mustDo(t, s.Characters.Update(ctx, liara.ID, &liara))
+
+	if results := find("tsoni"); len(results) != 1 {
+		t.Errorf("got %+v after renaming Liara", results)
+	}
+
+	mustDo(t, s.Characters.Delete(ctx, liara.ID))
+
+	if results := find("liara"); len(results) != 0 {
+		t.Errorf("got %+v after deleting Liara", results)
+	}
+
+	// Writes in a transaction show up once it is committed
+	err := s.Transaction(ctx, func(tx *store.Store) error {
+		return tx.Species.Create(ctx, &models.Species{Name: "Asari"})
+	})
+	mustDo(t, err)
+
+	if results := find("asari"); len(results) != 1 || results[0].Resource != store.ResourceSpecies {
+		t.Errorf("got %+v after creating the Asari in a transaction", results)
+	}
+}
@@ -0,0 +1,240 @@
+package seed
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+//go:embed data.json
+var dataFile []byte
+
+// Dataset is the canonical reference data. Characters refer to their species
+// and gender by name, so the dataset does not depend on database IDs.
+type Dataset struct {
+	Version    int                `json:"version"`
+	Species    []string           `json:"species"`
+	Genders    []string           `json:"genders"`
+	Characters []DatasetCharacter `json:"characters"`
+}
+
+type DatasetCharacter struct {
+	Name    string `json:"name"`
+	Species string `json:"species"`
+	Gender  string `json:"gender"`
+	Class   string `json:"class"`
+}
+
+// Result counts the records touched by a seed run
+type Result struct {
+	Created   int
+	Updated   int
+	Unchanged int
+}
+
+// Load parses the dataset embedded in the binary
+func Load() (*Dataset, error) {
+	var dataset Dataset
+
+	if err := json.Unmarshal(dataFile, &dataset); err != nil {
+		return nil, fmt.Errorf("failed to parse seed data: %w", err)
+	}
+
+	return &dataset, nil
+}
+
+// Run upserts the dataset into the store in a single transaction, so a
+// failure part way through leaves the store unchanged. Records are matched by
+// name ignoring case, like the importer, so running it again only updates
+// records whose data has changed.
+// Records that have been deleted are left deleted rather than created again,
+// and characters whose species or gender has been deleted are given none.
+func Run(ctx context.Context, s *store.Store, dataset *Dataset) (Result, error) {
+	var result Result
+
+	err := s.Transaction(ctx, func(tx *store.Store) error {
+		speciesIDs, err := upsertSpecies(ctx, tx.Species, dataset.Species, &result)
+
+		if err != nil {
+			return err
+		}
+
+		genderIDs, err := upsertGenders(ctx, tx.Genders, dataset.Genders, &result)
+
+		if err != nil {
+			return err
+		}
+
+		return upsertCharacters(ctx, tx.Characters, dataset.Characters, speciesIDs, genderIDs, &result)
+	})
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+func upsertSpecies(ctx context.Context, speciesStore store.SpeciesStore, names []string, result *Result) (map[string]int, error) {
+	existing, _, err := speciesStore.List(ctx, store.ListOptions{IncludeDeleted: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]int{}
+	deleted := map[string]bool{}
+
+	for _, species := range existing {
+		key := models.NameKey(species.Name)
+
+		if species.DeletedAt != nil {
+			deleted[key] = true
+		} else if _, ok := ids[key]; !ok {
+			ids[key] = species.ID
+		}
+	}
+
+	for _, name := range names {
+		key := models.NameKey(name)
+
+		if _, ok := ids[key]; ok {
+			result.Unchanged++
+			continue
+		}
+
+		// A deleted species stays deleted, and characters are left without one
+		if deleted[key] {
+			ids[key] = 0
+			result.Unchanged++
+			continue
+		}
+
+		species := models.Species{Name: name}
+
+		if err := speciesStore.Create(ctx, &species); err != nil {
+			return nil, fmt.Errorf("failed to create species %q: %w", name, err)
+		}
+
+		ids[key] = species.ID
+		result.Created++
+	}
+
+	return ids, nil
+}
+
+func upsertGenders(ctx context.Context, genderStore store.GenderStore, names []string, result *Result) (map[string]int, error) {
+	existing, _, err := genderStore.List(ctx, store.ListOptions{IncludeDeleted: true})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]int{}
+	deleted := map[string]bool{}
+
+	for _, gender := range existing {
+		key := models.NameKey(gender.Name)
+
+		if gender.DeletedAt != nil {
+			deleted[key] = true
+		} else if _, ok := ids[key]; !ok {
+			ids[key] = gender.ID
+		}
+	}
+
+	for _, name := range names {
+		key := models.NameKey(name)
+
+		if _, ok := ids[key]; ok {
+			result.Unchanged++
+			continue
+		}
+
+		// A deleted gender stays deleted, and characters are left without one
+		if deleted[key] {
+			ids[key] = 0
+			result.Unchanged++
+			continue
+		}
+
+		gender := models.Gender{Name: name}
+
+		if err := genderStore.Create(ctx, &gender); err != nil {
+			return nil, fmt.Errorf("failed to create gender %q: %w", name, err)
+		}
+
+		ids[key] = gender.ID
+		result.Created++
+	}
+
+	return ids, nil
+}
+
+func upsertCharacters(ctx context.Context, characterStore store.CharacterStore, characters []DatasetCharacter, speciesIDs, genderIDs map[string]int, result *Result) error {
+	existing, _, err := characterStore.List(ctx, store.CharacterFilter{}, store.ListOptions{IncludeDeleted: true})
+
+	if err != nil {
+		return err
+	}
+
+	current := map[string]models.CharacterObject{}
+
+	for _, character := range existing {
+		key := models.NameKey(character.Name)
+
+		// Prefer a character that hasn't been deleted over one that has
+		if stored, ok := current[key]; !ok || (stored.DeletedAt != nil && character.DeletedAt == nil) {
+			current[key] = character
+		}
+	}
+
+	for _, entry := range characters {
+		speciesID, ok := speciesIDs[models.NameKey(entry.Species)]
+
+		if !ok {
+			return fmt.Errorf("character %q has unknown species %q", entry.Name, entry.Species)
+		}
+
+		genderID, ok := genderIDs[models.NameKey(entry.Gender)]
+
+		if !ok {
+			return fmt.Errorf("character %q has unknown gender %q", entry.Name, entry.Gender)
+		}
+
+		character := models.Character{
+			Name:    entry.Name,
+			Species: speciesID,
+			Gender:  genderID,
+			Class:   entry.Class,
+		}
+
+		stored, ok := current[models.NameKey(entry.Name)]
+
+		if !ok {
+			if err := characterStore.Create(ctx, &character); err != nil {
+				return fmt.Errorf("failed to create character %q: %w", entry.Name, err)
+			}
+
+			result.Created++
+			continue
+		}
+
+		if stored.DeletedAt != nil || stored.Matches(character) {
+			result.Unchanged++
+			continue
+		}
+
+		if err := characterStore.Update(ctx, stored.ID, &character); err != nil {
+			return fmt.Errorf("failed to update character %q: %w", entry.Name, err)
+		}
+
+		result.Updated++
+	}
+
+	return nil
+}
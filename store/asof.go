@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/njwong/me-api/models"
+)
+
+type asOfKey struct{}
+
+// WithAsOf returns a context for reading records as they were at time t,
+// through a store wrapped by WithPointInTime
+func WithAsOf(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, asOfKey{}, t)
+}
+
+// asOf returns the time set by WithAsOf
+func asOf(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(asOfKey{}).(time.Time)
+	return t, ok
+}
+
+// WithPointInTime wraps every store in s so that List and Get calls made
+// with a context from WithAsOf return the records as they were then. Writes
+// are passed through unchanged.
+func WithPointInTime(s *Store) *Store {
+	return &Store{
+		Characters: &pointInTimeCharacterStore{CharacterStore: s.Characters, revisions: s.Revisions},
+		Genders:    &pointInTimeGenderStore{GenderStore: s.Genders, revisions: s.Revisions},
+		Species:    &pointInTimeSpeciesStore{SpeciesStore: s.Species, revisions: s.Revisions},
+		Audit:      s.Audit,
+		Revisions:  s.Revisions,
+
+		transaction: wrapTransaction(s, WithPointInTime),
+	}
+}
+
+// Snapshot returns an in-memory store holding the latest revision of every
+// character, species and gender at time t. It has no audit log or revisions
+// of its own. The whole dataset is rebuilt for each snapshot, which is fine
+// for reference data but wouldn't be for large tables.
+func Snapshot(ctx context.Context, revisions RevisionStore, t time.Time) (*Store, error) {
+	latest, err := revisions.AsOf(ctx, t)
+
+	if err != nil {
+		return nil, err
+	}
+
+	db := newMemoryDB()
+
+	for _, revision := range latest {
+		switch revision.Resource {
+		case ResourceCharacters:
+			err = restoreRevision(db.characters, db.deletedCharacters, revision)
+		case ResourceGenders:
+			err = restoreRevision(db.genders, db.deletedGenders, revision)
+		case ResourceSpecies:
+			err = restoreRevision(db.species, db.deletedSpecies, revision)
+		default:
+			err = fmt.Errorf("unknown resource %q", revision.Resource)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("revision %d of %s %d - %w", revision.Revision, revision.Resource, revision.ResourceID, err)
+		}
+	}
+
+	return &Store{
+		Characters: &memoryCharacterStore{db: db},
+		Genders:    &memoryGenderStore{db: db},
+		Species:    &memorySpeciesStore{db: db},
+	}, nil
+}
+
+// restoreRevision adds the record of a revision to table
+func restoreRevision[T any](table map[int]T, deleted map[int]time.Time, revision models.Revision) error {
+	var record T
+
+	if err := json.Unmarshal(revision.Record, &record); err != nil {
+		return err
+	}
+
+	table[revision.ResourceID] = record
+
+	if revision.Deleted {
+		deleted[revision.ResourceID] = revision.Time
+	}
+
+	return nil
+}
+
+// snapshotAt returns the snapshot to read from if ctx asks for a past time
+func snapshotAt(ctx context.Context, revisions RevisionStore) (*Store, bool, error) {
+	t, ok := asOf(ctx)
+
+	if !ok {
+		return nil, false, nil
+	}
+
+	snapshot, err := Snapshot(ctx, revisions, t)
+
+	return snapshot, true, err
+}
+
+type pointInTimeCharacterStore struct {
+	CharacterStore
+	revisions RevisionStore
+}
+
+func (s *pointInTimeCharacterStore) List(ctx context.Context, filter CharacterFilter, opts ListOptions) ([]models.CharacterObject, int, error) {
+	snapshot, ok, err := snapshotAt(ctx, s.revisions)
+
+	switch {
+	case err != nil:
+		return nil, 0, err
+	case ok:
+		return snapshot.Characters.List(ctx, filter, opts)
+	default:
+		return s.CharacterStore.List(ctx, filter, opts)
+	}
+}
+
+func (s *pointInTimeCharacterStore) Get(ctx context.Context, id int) (*models.CharacterObject, error) {
+	snapshot, ok, err := snapshotAt(ctx, s.revisions)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return snapshot.Characters.Get(ctx, id)
+	default:
+		return s.CharacterStore.Get(ctx, id)
+	}
+}
+
+type pointInTimeGenderStore struct {
+	GenderStore
+	revisions RevisionStore
+}
+
+func (s *pointInTimeGenderStore) List(ctx context.Context, opts ListOptions) ([]models.Gender, int, error) {
+	snapshot, ok, err := snapshotAt(ctx, s.revisions)
+
+	switch {
+	case err != nil:
+		return nil, 0, err
+	case ok:
+		return snapshot.Genders.List(ctx, opts)
+	default:
+		return s.GenderStore.List(ctx, opts)
+	}
+}
+
+func (s *pointInTimeGenderStore) Get(ctx context.Context, id int) (*models.Gender, error) {
+	snapshot, ok, err := snapshotAt(ctx, s.revisions)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return snapshot.Genders.Get(ctx, id)
+	default:
+		return s.GenderStore.Get(ctx, id)
+	}
+}
+
+type pointInTimeSpeciesStore struct {
+	SpeciesStore
+	revisions RevisionStore
+}
+
+func (s *pointInTimeSpeciesStore) List(ctx context.Context, opts ListOptions) ([]models.Species, int, error) {
+	snapshot, ok, err := snapshotAt(ctx, s.revisions)
+
+	switch {
+	case err != nil:
+		return nil, 0, err
+	case ok:
+		return snapshot.Species.List(ctx, opts)
+	default:
+		return s.SpeciesStore.List(ctx, opts)
+	}
+}
+
+func (s *pointInTimeSpeciesStore) Get(ctx context.Context, id int) (*models.Species, error) {
+	snapshot, ok, err := snapshotAt(ctx, s.revisions)
+
+	switch {
+	case err != nil:
+		return nil, err
+	case ok:
+		return snapshot.Species.Get(ctx, id)
+	default:
+		return s.SpeciesStore.Get(ctx, id)
+	}
+}
@@ -0,0 +1,283 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/njwong/me-api/models"
+)
+
+// CacheConfig bounds how long and how many results a Cache keeps
+type CacheConfig struct {
+	// TTL is how long a result is served from the cache before it is read
+	// again, or 0 to disable caching
+	TTL time.Duration
+
+	// MaxEntries is the number of results kept, the least recently used
+	// result is evicted once it is reached
+	MaxEntries int
+}
+
+// CacheStats counts how the cache has been used since it was created
+type CacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+// Cache keeps the results of reads in memory. Characters include the names
+// of their species and gender, so every write clears the whole cache rather
+// than trying to work out which results it affected.
+type Cache struct {
+	config CacheConfig
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	recent     *list.List
+	generation uint64
+	stats      CacheStats
+}
+
+type cacheEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func NewCache(config CacheConfig) *Cache {
+	return &Cache{
+		config:  config,
+		entries: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+// WithCache wraps every store in s so that reads are served from a new cache
+// and writes through the returned store invalidate it
+func WithCache(s *Store, config CacheConfig) (*Store, *Cache) {
+	cache := NewCache(config)
+
+	cached := &Store{
+		Characters: &cachedCharacterStore{CharacterStore: s.Characters, cache: cache},
+		Genders:    &cachedGenderStore{GenderStore: s.Genders, cache: cache},
+		Species:    &cachedSpeciesStore{SpeciesStore: s.Species, cache: cache},
+		Audit:      s.Audit,
+		Revisions:  s.Revisions,
+
+		// Reads within a transaction go straight to s, as they may see
+		// changes that haven't been committed
+		transaction: s.transaction,
+	}
+
+	return WithWriteHook(cached, cache.Invalidate), cache
+}
+
+// Invalidate clears the cache. It can be used as a WriteHook.
+func (c *Cache) Invalidate(ctx context.Context, resource string, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.recent.Init()
+	c.generation++
+}
+
+// Stats returns the hit and miss counters and the current number of entries
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.recent.Len()
+	return stats
+}
+
+// lookup returns the cached value for key, along with the generation to pass
+// to store if it isn't cached
+func (c *Cache) lookup(key string) (any, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+
+	if ok && time.Now().Before(element.Value.(*cacheEntry).expires) {
+		c.stats.Hits++
+		c.recent.MoveToFront(element)
+		return element.Value.(*cacheEntry).value, c.generation, true
+	}
+
+	if ok {
+		c.recent.Remove(element)
+		delete(c.entries, key)
+	}
+
+	c.stats.Misses++
+	return nil, c.generation, false
+}
+
+// store caches value under key, unless the cache was invalidated since the
+// value was looked up, in which case it may already be out of date
+func (c *Cache) store(key string, value any, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation || c.config.TTL <= 0 || c.config.MaxEntries < 1 {
+		return
+	}
+
+	entry := &cacheEntry{key: key, value: value, expires: time.Now().Add(c.config.TTL)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.recent.PushFront(entry)
+
+	for c.recent.Len() > c.config.MaxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// cached returns the result of load for key, from the cache if possible.
+// Callers get their own copy made by clone, as handlers change the records
+// they are given, e.g. to set their URLs.
+func cached[T any](c *Cache, key string, load func() (T, error), clone func(T) T) (T, error) {
+	hit, generation, ok := c.lookup(key)
+
+	if ok {
+		return clone(hit.(T)), nil
+	}
+
+	value, err := load()
+
+	if err != nil {
+		return value, err
+	}
+
+	c.store(key, value, generation)
+
+	return clone(value), nil
+}
+
+// listResult is a cached page of records and the total number of records
+type listResult[T any] struct {
+	records []T
+	total   int
+}
+
+func cloneList[T any](clone func(T) T) func(listResult[T]) listResult[T] {
+	return func(result listResult[T]) listResult[T] {
+		records := make([]T, len(result.records))
+
+		for i, record := range result.records {
+			records[i] = clone(record)
+		}
+
+		return listResult[T]{records: records, total: result.total}
+	}
+}
+
+func clonePointer[T any](record *T) *T {
+	copied := *record
+	return &copied
+}
+
+func cloneValue[T any](record T) T {
+	return record
+}
+
+func cloneCharacter(character models.CharacterObject) models.CharacterObject {
+	if character.Species != nil {
+		character.Species = clonePointer(character.Species)
+	}
+
+	if character.Gender != nil {
+		character.Gender = clonePointer(character.Gender)
+	}
+
+	return character
+}
+
+type cachedCharacterStore struct {
+	CharacterStore
+	cache *Cache
+}
+
+func (s *cachedCharacterStore) List(ctx context.Context, filter CharacterFilter, opts ListOptions) ([]models.CharacterObject, int, error) {
+	key := fmt.Sprintf("%s:list:%+v:%+v", ResourceCharacters, filter, opts)
+
+	result, err := cached(s.cache, key, func() (listResult[models.CharacterObject], error) {
+		characters, total, err := s.CharacterStore.List(ctx, filter, opts)
+		return listResult[models.CharacterObject]{characters, total}, err
+	}, cloneList(cloneCharacter))
+
+	return result.records, result.total, err
+}
+
+func (s *cachedCharacterStore) Get(ctx context.Context, id int) (*models.CharacterObject, error) {
+	key := fmt.Sprintf("%s:get:%d", ResourceCharacters, id)
+
+	return cached(s.cache, key, func() (*models.CharacterObject, error) {
+		return s.CharacterStore.Get(ctx, id)
+	}, func(character *models.CharacterObject) *models.CharacterObject {
+		copied := cloneCharacter(*character)
+		return &copied
+	})
+}
+
+type cachedGenderStore struct {
+	GenderStore
+	cache *Cache
+}
+
+func (s *cachedGenderStore) List(ctx context.Context, opts ListOptions) ([]models.Gender, int, error) {
+	key := fmt.Sprintf("%s:list:%+v", ResourceGenders, opts)
+
+	result, err := cached(s.cache, key, func() (listResult[models.Gender], error) {
+		genders, total, err := s.GenderStore.List(ctx, opts)
+		return listResult[models.Gender]{genders, total}, err
+	}, cloneList(cloneValue[models.Gender]))
+
+	return result.records, result.total, err
+}
+
+func (s *cachedGenderStore) Get(ctx context.Context, id int) (*models.Gender, error) {
+	key := fmt.Sprintf("%s:get:%d", ResourceGenders, id)
+
+	return cached(s.cache, key, func() (*models.Gender, error) {
+		return s.GenderStore.Get(ctx, id)
+	}, clonePointer[models.Gender])
+}
+
+type cachedSpeciesStore struct {
+	SpeciesStore
+	cache *Cache
+}
+
+func (s *cachedSpeciesStore) List(ctx context.Context, opts ListOptions) ([]models.Species, int, error) {
+	key := fmt.Sprintf("%s:list:%+v", ResourceSpecies, opts)
+
+	result, err := cached(s.cache, key, func() (listResult[models.Species], error) {
+		species, total, err := s.SpeciesStore.List(ctx, opts)
+		return listResult[models.Species]{species, total}, err
+	}, cloneList(cloneValue[models.Species]))
+
+	return result.records, result.total, err
+}
+
+func (s *cachedSpeciesStore) Get(ctx context.Context, id int) (*models.Species, error) {
+	key := fmt.Sprintf("%s:get:%d", ResourceSpecies, id)
+
+	return cached(s.cache, key, func() (*models.Species, error) {
+		return s.SpeciesStore.Get(ctx, id)
+	}, clonePointer[models.Species])
+}
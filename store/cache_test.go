@@ -0,0 +1,220 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+var errRollback = errors.New("roll back")
+
+// listGenders returns the names of the genders in s
+func listGenders(t *testing.T, s *store.Store) []string {
+	t.Helper()
+
+	genders, _, err := s.Genders.List(context.Background(), store.ListOptions{})
+	mustDo(t, err)
+
+	names := []string{}
+
+	for _, gender := range genders {
+		names = append(names, gender.Name)
+	}
+
+	return names
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		ttl    time.Duration
+		hits   uint64
+		misses uint64
+	}{
+		{"fresh", time.Hour, 2, 1},
+		{"expired", time.Nanosecond, 0, 3},
+		{"disabled", 0, 0, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, cache := store.WithCache(store.NewMemory(), store.CacheConfig{TTL: test.ttl, MaxEntries: 10})
+
+			gender := models.Gender{Name: "Female"}
+			mustDo(t, s.Genders.Create(ctx, &gender))
+
+			for i := 0; i < 3; i++ {
+				stored, err := s.Genders.Get(ctx, gender.ID)
+				mustDo(t, err)
+
+				if stored.Name != gender.Name {
+					t.Fatalf("got %+v", stored)
+				}
+			}
+
+			if stats := cache.Stats(); stats.Hits != test.hits || stats.Misses != test.misses {
+				t.Errorf("got %+v, want %d hits and %d misses", stats, test.hits, test.misses)
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	s, cache := store.WithCache(store.NewMemory(), store.CacheConfig{TTL: time.Hour, MaxEntries: 2})
+
+	for _, name := range []string{"Male", "Female", "Genderless"} {
+		mustDo(t, s.Genders.Create(ctx, &models.Gender{Name: name}))
+	}
+
+	for _, id := range []int{1, 2, 3} {
+		_, err := s.Genders.Get(ctx, id)
+		mustDo(t, err)
+	}
+
+	// The first gender was the least recently used
+	hits := cache.Stats().Hits
+
+	for _, id := range []int{3, 2} {
+		_, err := s.Genders.Get(ctx, id)
+		mustDo(t, err)
+	}
+
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 1 || stats.Hits != hits+2 {
+		t.Errorf("got %+v, want the last 2 genders cached after 1 eviction", stats)
+	}
+}
+
+// TestCacheInvalidation checks that writes through the cached store clear
+// it, so the next read sees them
+func TestCacheInvalidation(t *testing.T) {
+	eachStore(t, func(t *testing.T, base *store.Store) {
+		ctx := context.Background()
+		s, cache := store.WithCache(base, store.CacheConfig{TTL: time.Hour, MaxEntries: 10})
+
+		gender := models.Gender{Name: "Male"}
+		mustDo(t, s.Genders.Create(ctx, &gender))
+		listGenders(t, s)
+
+		gender.Name = "Female"
+		mustDo(t, s.Genders.Update(ctx, gender.ID, &gender))
+
+		if stats := cache.Stats(); stats.Entries != 0 {
+			t.Errorf("update left %d entries", stats.Entries)
+		}
+
+		if names := listGenders(t, s); len(names) != 1 || names[0] != "Female" {
+			t.Errorf("got %v after the update", names)
+		}
+
+		mustDo(t, s.Genders.Delete(ctx, gender.ID, store.DeleteOptions{Policy: store.Restrict}))
+
+		if names := listGenders(t, s); len(names) != 0 {
+			t.Errorf("got %v after the delete", names)
+		}
+	})
+}
+
+// writingGenderStore makes a write part way through each List, after the
+// genders have been read
+type writingGenderStore struct {
+	store.GenderStore
+	write func()
+}
+
+func (s *writingGenderStore) List(ctx context.Context, opts store.ListOptions) ([]models.Gender, int, error) {
+	genders, total, err := s.GenderStore.List(ctx, opts)
+	s.write()
+	return genders, total, err
+}
+
+// TestCacheGeneration checks that a result read before a write isn't cached
+// after it, as it may be out of date
+func TestCacheGeneration(t *testing.T) {
+	ctx := context.Background()
+	base := store.NewMemory()
+	writing := &writingGenderStore{GenderStore: base.Genders, write: func() {}}
+
+	s, cache := store.WithCache(&store.Store{
+		Characters: base.Characters,
+		Genders:    writing,
+		Species:    base.Species,
+		Audit:      base.Audit,
+		Revisions:  base.Revisions,
+	}, store.CacheConfig{TTL: time.Hour, MaxEntries: 10})
+
+	writing.write = func() {
+		writing.write = func() {}
+		mustDo(t, s.Genders.Create(ctx, &models.Gender{Name: "Female"}))
+	}
+
+	if names := listGenders(t, s); len(names) != 0 {
+		t.Fatalf("got %v from before the write", names)
+	}
+
+	if stats := cache.Stats(); stats.Entries != 0 {
+		t.Errorf("the result from before the write was cached, %+v", stats)
+	}
+
+	if names := listGenders(t, s); len(names) != 1 {
+		t.Errorf("got %v after the write", names)
+	}
+}
+
+// TestCacheTransaction checks that reads in a transaction aren't cached, as
+// they see uncommitted writes, and that the cache is only invalidated once
+// the transaction commits
+func TestCacheTransaction(t *testing.T) {
+	eachStore(t, func(t *testing.T, base *store.Store) {
+		ctx := context.Background()
+		s, cache := store.WithCache(base, store.CacheConfig{TTL: time.Hour, MaxEntries: 10})
+
+		mustDo(t, s.Genders.Create(ctx, &models.Gender{Name: "Male"}))
+		listGenders(t, s)
+
+		for _, commit := range []bool{false, true} {
+			err := s.Transaction(ctx, func(tx *store.Store) error {
+				mustDo(t, tx.Genders.Create(ctx, &models.Gender{Name: "Female"}))
+
+				if names := listGenders(t, tx); len(names) != 2 {
+					t.Errorf("got %v in the transaction", names)
+				}
+
+				if stats := cache.Stats(); stats.Entries != 1 {
+					t.Errorf("got %+v in the transaction, want only the list from before it", stats)
+				}
+
+				if !commit {
+					return errRollback
+				}
+
+				return nil
+			})
+
+			if !commit {
+				if !errors.Is(err, errRollback) {
+					t.Fatalf("rolled back transaction gave %v", err)
+				}
+
+				hits := cache.Stats().Hits
+
+				if names := listGenders(t, s); len(names) != 1 || cache.Stats().Hits != hits+1 {
+					t.Errorf("got %v after the rollback, with %+v", names, cache.Stats())
+				}
+
+				continue
+			}
+
+			mustDo(t, err)
+
+			if names := listGenders(t, s); len(names) != 2 {
+				t.Errorf("got %v after the commit", names)
+			}
+		}
+	})
+}
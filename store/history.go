@@ -0,0 +1,428 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/patch"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+)
+
+// Actor identifies who is making changes, and in which request
+type Actor struct {
+	Subject   string
+	RequestID string
+}
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes changes made with it to actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, or the zero Actor
+func ActorFrom(ctx context.Context) Actor {
+	actor, _ := ctx.Value(actorKey{}).(Actor)
+	return actor
+}
+
+// WithHistory wraps every store in s so that each successful write is
+// recorded in s.Audit, along with the record before and after it, and adds a
+// revision of the record to s.Revisions. Characters changed by deleting a
+// species or gender are recorded as updates. Each write is made in a
+// transaction with its records, so a write that can't be recorded fails and
+// is rolled back.
+func WithHistory(s *Store) *Store {
+	return &Store{
+		Characters: &auditedCharacterStore{CharacterStore: s.Characters, store: s},
+		Genders:    &auditedGenderStore{GenderStore: s.Genders, store: s},
+		Species:    &auditedSpeciesStore{SpeciesStore: s.Species, store: s},
+		Audit:      s.Audit,
+		Revisions:  s.Revisions,
+
+		transaction: wrapTransaction(s, WithHistory),
+	}
+}
+
+// history records the writes made in a transaction
+type history struct {
+	audit      AuditStore
+	revisions  RevisionStore
+	characters CharacterStore
+}
+
+// withHistory runs fn in a transaction of s, with a history that records to
+// the same transaction
+func withHistory(ctx context.Context, s *Store, fn func(tx *Store, h *history) error) error {
+	return s.Transaction(ctx, func(tx *Store) error {
+		return fn(tx, &history{audit: tx.Audit, revisions: tx.Revisions, characters: tx.Characters})
+	})
+}
+
+// record adds an entry for a write to the audit log, and the revision it
+// made. before and after are nil when the record didn't exist or was deleted.
+func (a *history) record(ctx context.Context, action string, resource string, id int, before, after any) error {
+	actor := ActorFrom(ctx)
+
+	entry := models.AuditEntry{
+		Time:       time.Now().UTC(),
+		Actor:      actor.Subject,
+		RequestID:  actor.RequestID,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: id,
+	}
+
+	err := snapshot(before, &entry.Before)
+
+	if err == nil {
+		err = snapshot(after, &entry.After)
+	}
+
+	if err == nil && entry.Before != nil && entry.After != nil {
+		entry.Changes, err = patch.Diff(entry.Before, entry.After)
+	}
+
+	if err == nil {
+		err = a.audit.Record(ctx, &entry)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to audit %s of %s %d: %w", action, resource, id, err)
+	}
+
+	revision := models.Revision{
+		Time:       entry.Time,
+		Action:     action,
+		Record:     entry.After,
+		Resource:   resource,
+		ResourceID: id,
+	}
+
+	// A deleted record keeps the state it was deleted in
+	if action == ActionDelete {
+		revision.Record = entry.Before
+		revision.Deleted = true
+	}
+
+	if revision.Record == nil {
+		return nil
+	}
+
+	if err := a.revisions.Record(ctx, &revision); err != nil {
+		return fmt.Errorf("failed to record revision of %s %d: %w", resource, id, err)
+	}
+
+	return nil
+}
+
+// recordWrite records a write, reading the record after it with get
+func recordWrite[T any](ctx context.Context, a *history, action string, resource string, id int, before any, get func(context.Context, int) (*T, error)) error {
+	after, err := current(ctx, get, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to audit %s of %s %d: %w", action, resource, id, err)
+	}
+
+	return a.record(ctx, action, resource, id, before, after)
+}
+
+// snapshot encodes a record for the audit log and revisions, leaving out its URL which the
+// stores never set
+func snapshot(record any, out *json.RawMessage) error {
+	if record == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	delete(fields, "url")
+
+	*out, err = json.Marshal(fields)
+	return err
+}
+
+// current returns the stored record with id, or nil if there isn't one. The
+// result is an interface so that a missing record is an untyped nil.
+func current[T any](ctx context.Context, get func(context.Context, int) (*T, error), id int) (any, error) {
+	record, err := get(ctx, id)
+
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// character returns a stored character in the form it is written in
+func (a *history) character(ctx context.Context, id int) (*models.Character, error) {
+	object, err := a.characters.Get(ctx, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return characterRow(*object), nil
+}
+
+// characterRow converts a character back to the form it is written in, with
+// the IDs of its species and gender
+func characterRow(object models.CharacterObject) *models.Character {
+	return &models.Character{
+		ID:      object.ID,
+		Name:    object.Name,
+		Species: object.SpeciesID(),
+		Gender:  object.GenderID(),
+		Class:   object.Class,
+	}
+}
+
+// referencing returns the characters that a delete with opts will change,
+// keyed by ID
+func (a *history) referencing(ctx context.Context, filter CharacterFilter, opts DeleteOptions) (map[int]any, error) {
+	characters := map[int]any{}
+
+	if opts.Policy != Nullify && opts.Policy != Reassign {
+		return characters, nil
+	}
+
+	list, _, err := a.characters.List(ctx, filter, ListOptions{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range list {
+		characters[object.ID] = characterRow(object)
+	}
+
+	return characters, nil
+}
+
+// recordReferences records the changes a delete made to characters
+func (a *history) recordReferences(ctx context.Context, characters map[int]any) error {
+	for _, id := range sortedIDs(characters) {
+		if err := recordWrite(ctx, a, ActionUpdate, ResourceCharacters, id, characters[id], a.character); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type auditedCharacterStore struct {
+	CharacterStore
+	store *Store
+}
+
+func (s *auditedCharacterStore) Create(ctx context.Context, character *models.Character) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		if err := tx.Characters.Create(ctx, character); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionCreate, ResourceCharacters, character.ID, nil, h.character)
+	})
+}
+
+func (s *auditedCharacterStore) Update(ctx context.Context, id int, character *models.Character) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		before, err := current(ctx, h.character, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Characters.Update(ctx, id, character); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionUpdate, ResourceCharacters, id, before, h.character)
+	})
+}
+
+func (s *auditedCharacterStore) Delete(ctx context.Context, id int) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		before, err := current(ctx, h.character, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Characters.Delete(ctx, id); err != nil {
+			return err
+		}
+
+		return h.record(ctx, ActionDelete, ResourceCharacters, id, before, nil)
+	})
+}
+
+func (s *auditedCharacterStore) Restore(ctx context.Context, id int) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		if err := tx.Characters.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionRestore, ResourceCharacters, id, nil, h.character)
+	})
+}
+
+type auditedGenderStore struct {
+	GenderStore
+	store *Store
+}
+
+func (s *auditedGenderStore) Create(ctx context.Context, gender *models.Gender) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		if err := tx.Genders.Create(ctx, gender); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionCreate, ResourceGenders, gender.ID, nil, tx.Genders.Get)
+	})
+}
+
+func (s *auditedGenderStore) Update(ctx context.Context, id int, gender *models.Gender) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		before, err := current(ctx, tx.Genders.Get, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Genders.Update(ctx, id, gender); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionUpdate, ResourceGenders, id, before, tx.Genders.Get)
+	})
+}
+
+func (s *auditedGenderStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		before, err := current(ctx, tx.Genders.Get, id)
+
+		if err != nil {
+			return err
+		}
+
+		characters, err := h.referencing(ctx, CharacterFilter{GenderID: id}, opts)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Genders.Delete(ctx, id, opts); err != nil {
+			return err
+		}
+
+		if err := h.record(ctx, ActionDelete, ResourceGenders, id, before, nil); err != nil {
+			return err
+		}
+
+		return h.recordReferences(ctx, characters)
+	})
+}
+
+func (s *auditedGenderStore) Restore(ctx context.Context, id int) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		if err := tx.Genders.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionRestore, ResourceGenders, id, nil, tx.Genders.Get)
+	})
+}
+
+type auditedSpeciesStore struct {
+	SpeciesStore
+	store *Store
+}
+
+func (s *auditedSpeciesStore) Create(ctx context.Context, species *models.Species) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		if err := tx.Species.Create(ctx, species); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionCreate, ResourceSpecies, species.ID, nil, tx.Species.Get)
+	})
+}
+
+func (s *auditedSpeciesStore) Update(ctx context.Context, id int, species *models.Species) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		before, err := current(ctx, tx.Species.Get, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Species.Update(ctx, id, species); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionUpdate, ResourceSpecies, id, before, tx.Species.Get)
+	})
+}
+
+func (s *auditedSpeciesStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		before, err := current(ctx, tx.Species.Get, id)
+
+		if err != nil {
+			return err
+		}
+
+		characters, err := h.referencing(ctx, CharacterFilter{SpeciesID: id}, opts)
+
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Species.Delete(ctx, id, opts); err != nil {
+			return err
+		}
+
+		if err := h.record(ctx, ActionDelete, ResourceSpecies, id, before, nil); err != nil {
+			return err
+		}
+
+		return h.recordReferences(ctx, characters)
+	})
+}
+
+func (s *auditedSpeciesStore) Restore(ctx context.Context, id int) error {
+	return withHistory(ctx, s.store, func(tx *Store, h *history) error {
+		if err := tx.Species.Restore(ctx, id); err != nil {
+			return err
+		}
+
+		return recordWrite(ctx, h, ActionRestore, ResourceSpecies, id, nil, tx.Species.Get)
+	})
+}
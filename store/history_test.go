@@ -0,0 +1,154 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// TestHistoryRolledBack checks that writes and their history are committed
+// together, so a write that is rolled back leaves nothing in the history
+func TestHistoryRolledBack(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		s = store.WithHistory(s)
+
+		gender := models.Gender{Name: "Female"}
+		mustDo(t, s.Genders.Create(ctx, &gender))
+
+		failed := errors.New("failed")
+
+		err := s.Transaction(ctx, func(tx *store.Store) error {
+			if err := tx.Genders.Update(ctx, gender.ID, &models.Gender{Name: "Male"}); err != nil {
+				return err
+			}
+
+			return failed
+		})
+
+		if !errors.Is(err, failed) {
+			t.Fatalf("got %v, want %v", err, failed)
+		}
+
+		entries, total, err := s.Audit.List(ctx, store.AuditFilter{}, store.ListOptions{})
+		mustDo(t, err)
+
+		if total != 1 || entries[0].Action != store.ActionCreate {
+			t.Errorf("got %d audit entries, want only the create", total)
+		}
+
+		_, total, err = s.Revisions.List(ctx, store.ResourceGenders, gender.ID, store.ListOptions{})
+		mustDo(t, err)
+
+		if total != 1 {
+			t.Errorf("got %d revisions, want 1", total)
+		}
+	})
+}
+
+// TestHistoryFailure checks that a write fails and is rolled back when it
+// can't be recorded
+func TestHistoryFailure(t *testing.T) {
+	ctx := context.Background()
+	db := newSQLiteDB(t)
+	s := store.WithHistory(store.NewSQL(db))
+
+	species := models.Species{Name: "Turian"}
+	mustDo(t, s.Species.Create(ctx, &species))
+
+	if _, err := db.Exec("DROP TABLE revisions"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Species.Update(ctx, species.ID, &models.Species{Name: "Quarian"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	stored, err := s.Species.Get(ctx, species.ID)
+	mustDo(t, err)
+
+	if stored.Name != "Turian" {
+		t.Errorf("got %q, want the update rolled back", stored.Name)
+	}
+
+	_, total, err := s.Audit.List(ctx, store.AuditFilter{}, store.ListOptions{})
+	mustDo(t, err)
+
+	if total != 1 {
+		t.Errorf("got %d audit entries, want 1", total)
+	}
+}
+
+// TestHistoryReferences checks that characters changed by deleting their
+// gender are recorded as updated
+func TestHistoryReferences(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		s = store.WithHistory(s)
+		f := newFixture(t, s)
+
+		mustDo(t, s.Genders.Delete(ctx, f.gender.ID, store.DeleteOptions{Policy: store.Nullify}))
+
+		entries, _, err := s.Audit.List(ctx, store.AuditFilter{Resource: store.ResourceCharacters, ResourceID: f.live.ID}, store.ListOptions{})
+		mustDo(t, err)
+
+		last := entries[len(entries)-1]
+
+		if last.Action != store.ActionUpdate || string(last.Changes) != `[{"op":"replace","path":"/gender","value":0}]` {
+			t.Errorf("got %s with changes %s", last.Action, last.Changes)
+		}
+
+		revisions, total, err := s.Revisions.List(ctx, store.ResourceCharacters, f.live.ID, store.ListOptions{})
+		mustDo(t, err)
+
+		if total != 2 || revisions[1].Action != store.ActionUpdate {
+			t.Errorf("got %d revisions, want a create and an update", total)
+		}
+	})
+}
+
+// TestHistoryConcurrentRevisions checks that concurrent writes to a record
+// are all recorded, with consecutive revision numbers
+func TestHistoryConcurrentRevisions(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		s = store.WithHistory(s)
+
+		species := models.Species{Name: "Salarian"}
+		mustDo(t, s.Species.Create(ctx, &species))
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+
+			go func(i int) {
+				defer wg.Done()
+
+				if err := s.Species.Update(ctx, species.ID, &models.Species{Name: fmt.Sprint("Salarian ", i)}); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+
+		wg.Wait()
+
+		revisions, total, err := s.Revisions.List(ctx, store.ResourceSpecies, species.ID, store.ListOptions{})
+		mustDo(t, err)
+
+		if total != 21 {
+			t.Fatalf("got %d revisions, want 21", total)
+		}
+
+		for i, revision := range revisions {
+			if revision.Revision != i+1 {
+				t.Errorf("revision %d is numbered %d", i+1, revision.Revision)
+			}
+		}
+	})
+}
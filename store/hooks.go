@@ -0,0 +1,184 @@
+package store
+
+import (
+	"context"
+
+	"github.com/njwong/me-api/models"
+)
+
+// Resource names passed to write hooks
+const (
+	ResourceCharacters = "characters"
+	ResourceGenders    = "genders"
+	ResourceSpecies    = "species"
+)
+
+// WriteHook is called after a record has been successfully created, updated,
+// deleted or restored through the store
+type WriteHook func(ctx context.Context, resource string, id int)
+
+// WithWriteHook wraps every store in s so that hook is called after each write
+func WithWriteHook(s *Store, hook WriteHook) *Store {
+	return &Store{
+		Characters: &hookedCharacterStore{CharacterStore: s.Characters, hook: hook},
+		Genders:    &hookedGenderStore{GenderStore: s.Genders, hook: hook},
+		Species:    &hookedSpeciesStore{SpeciesStore: s.Species, hook: hook},
+		Audit:      s.Audit,
+		Revisions:  s.Revisions,
+
+		transaction: deferHooks(s, hook),
+	}
+}
+
+// write is a call to a write hook
+type write struct {
+	resource string
+	id       int
+}
+
+// deferHooks returns the transaction function for s wrapped by WithWriteHook,
+// which holds back the calls to hook until the transaction has been committed
+func deferHooks(s *Store, hook WriteHook) func(ctx context.Context, fn func(tx *Store) error) error {
+	return func(ctx context.Context, fn func(tx *Store) error) error {
+		writes := []write{}
+
+		err := s.Transaction(ctx, func(tx *Store) error {
+			return fn(WithWriteHook(tx, func(ctx context.Context, resource string, id int) {
+				writes = append(writes, write{resource, id})
+			}))
+		})
+
+		if err != nil {
+			return err
+		}
+
+		for _, w := range writes {
+			hook(ctx, w.resource, w.id)
+		}
+
+		return nil
+	}
+}
+
+type hookedCharacterStore struct {
+	CharacterStore
+	hook WriteHook
+}
+
+func (s *hookedCharacterStore) Create(ctx context.Context, character *models.Character) error {
+	if err := s.CharacterStore.Create(ctx, character); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceCharacters, character.ID)
+	return nil
+}
+
+func (s *hookedCharacterStore) Update(ctx context.Context, id int, character *models.Character) error {
+	if err := s.CharacterStore.Update(ctx, id, character); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceCharacters, id)
+	return nil
+}
+
+func (s *hookedCharacterStore) Delete(ctx context.Context, id int) error {
+	if err := s.CharacterStore.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceCharacters, id)
+	return nil
+}
+
+func (s *hookedCharacterStore) Restore(ctx context.Context, id int) error {
+	if err := s.CharacterStore.Restore(ctx, id); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceCharacters, id)
+	return nil
+}
+
+type hookedGenderStore struct {
+	GenderStore
+	hook WriteHook
+}
+
+func (s *hookedGenderStore) Create(ctx context.Context, gender *models.Gender) error {
+	if err := s.GenderStore.Create(ctx, gender); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceGenders, gender.ID)
+	return nil
+}
+
+func (s *hookedGenderStore) Update(ctx context.Context, id int, gender *models.Gender) error {
+	if err := s.GenderStore.Update(ctx, id, gender); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceGenders, id)
+	return nil
+}
+
+func (s *hookedGenderStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	if err := s.GenderStore.Delete(ctx, id, opts); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceGenders, id)
+	return nil
+}
+
+func (s *hookedGenderStore) Restore(ctx context.Context, id int) error {
+	if err := s.GenderStore.Restore(ctx, id); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceGenders, id)
+	return nil
+}
+
+type hookedSpeciesStore struct {
+	SpeciesStore
+	hook WriteHook
+}
+
+func (s *hookedSpeciesStore) Create(ctx context.Context, species *models.Species) error {
+	if err := s.SpeciesStore.Create(ctx, species); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceSpecies, species.ID)
+	return nil
+}
+
+func (s *hookedSpeciesStore) Update(ctx context.Context, id int, species *models.Species) error {
+	if err := s.SpeciesStore.Update(ctx, id, species); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceSpecies, id)
+	return nil
+}
+
+func (s *hookedSpeciesStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	if err := s.SpeciesStore.Delete(ctx, id, opts); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceSpecies, id)
+	return nil
+}
+
+func (s *hookedSpeciesStore) Restore(ctx context.Context, id int) error {
+	if err := s.SpeciesStore.Restore(ctx, id); err != nil {
+		return err
+	}
+
+	s.hook(ctx, ResourceSpecies, id)
+	return nil
+}
@@ -0,0 +1,839 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/njwong/me-api/models"
+)
+
+// NewMemory creates a store that keeps all records in memory. Nothing is
+// persisted, so it is only suitable for tests and local demos.
+func NewMemory() *Store {
+	audit := &memoryAuditStore{}
+	revisions := &memoryRevisionStore{revisions: map[revisionKey][]models.Revision{}}
+
+	return newMemoryStore(newMemoryDB(), audit, revisions)
+}
+
+// newMemoryStore creates a store for the given tables. Transactions work on
+// a copy of them, which replaces the originals when it is committed. Other
+// reads and writes wait until then.
+func newMemoryStore(db *memoryDB, audit *memoryAuditStore, revisions *memoryRevisionStore) *Store {
+	return &Store{
+		Characters: &memoryCharacterStore{db: db},
+		Genders:    &memoryGenderStore{db: db},
+		Species:    &memorySpeciesStore{db: db},
+		Audit:      audit,
+		Revisions:  revisions,
+
+		transaction: func(ctx context.Context, fn func(tx *Store) error) error {
+			db.mu.Lock()
+			defer db.mu.Unlock()
+
+			audit.mu.Lock()
+			defer audit.mu.Unlock()
+
+			revisions.mu.Lock()
+			defer revisions.mu.Unlock()
+
+			txDB := db.copy()
+			txAudit := &memoryAuditStore{entries: append([]models.AuditEntry{}, audit.entries...)}
+			txRevisions := &memoryRevisionStore{revisions: copyRevisions(revisions.revisions)}
+
+			if err := fn(newMemoryStore(txDB, txAudit, txRevisions)); err != nil {
+				return err
+			}
+
+			db.replace(txDB)
+			audit.entries = txAudit.entries
+			revisions.revisions = txRevisions.revisions
+
+			return nil
+		},
+	}
+}
+
+// memoryDB holds the tables shared by the in-memory stores, so that
+// characters can be joined to their species and gender like in MySQL
+type memoryDB struct {
+	mu sync.RWMutex
+
+	characters map[int]models.Character
+	genders    map[int]models.Gender
+	species    map[int]models.Species
+
+	// When each soft deleted record was deleted
+	deletedCharacters map[int]time.Time
+	deletedGenders    map[int]time.Time
+	deletedSpecies    map[int]time.Time
+
+	lastCharacterID int
+	lastGenderID    int
+	lastSpeciesID   int
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{
+		characters: map[int]models.Character{},
+		genders:    map[int]models.Gender{},
+		species:    map[int]models.Species{},
+
+		deletedCharacters: map[int]time.Time{},
+		deletedGenders:    map[int]time.Time{},
+		deletedSpecies:    map[int]time.Time{},
+	}
+}
+
+// copy returns a copy of the tables. The caller must hold the lock.
+func (db *memoryDB) copy() *memoryDB {
+	return &memoryDB{
+		characters: copyTable(db.characters),
+		genders:    copyTable(db.genders),
+		species:    copyTable(db.species),
+
+		deletedCharacters: copyTable(db.deletedCharacters),
+		deletedGenders:    copyTable(db.deletedGenders),
+		deletedSpecies:    copyTable(db.deletedSpecies),
+
+		lastCharacterID: db.lastCharacterID,
+		lastGenderID:    db.lastGenderID,
+		lastSpeciesID:   db.lastSpeciesID,
+	}
+}
+
+// replace swaps the tables for those of a copy. The caller must hold the lock.
+func (db *memoryDB) replace(from *memoryDB) {
+	db.characters, db.genders, db.species = from.characters, from.genders, from.species
+	db.deletedCharacters, db.deletedGenders, db.deletedSpecies = from.deletedCharacters, from.deletedGenders, from.deletedSpecies
+	db.lastCharacterID, db.lastGenderID, db.lastSpeciesID = from.lastCharacterID, from.lastGenderID, from.lastSpeciesID
+}
+
+func copyTable[T any](table map[int]T) map[int]T {
+	copied := make(map[int]T, len(table))
+
+	for id, row := range table {
+		copied[id] = row
+	}
+
+	return copied
+}
+
+// checkReferences returns a MissingReferenceError if the character's species
+// or gender doesn't exist or has been deleted. The caller must hold the lock.
+func (db *memoryDB) checkReferences(character *models.Character) error {
+	if character.Species != 0 && !exists(db.species, db.deletedSpecies, character.Species) {
+		return &MissingReferenceError{Field: "species", ID: character.Species}
+	}
+
+	if character.Gender != 0 && !exists(db.genders, db.deletedGenders, character.Gender) {
+		return &MissingReferenceError{Field: "gender", ID: character.Gender}
+	}
+
+	return nil
+}
+
+// joinCharacter adds a character's species and gender, like a LEFT JOIN
+func (db *memoryDB) joinCharacter(row models.Character) models.CharacterObject {
+	character := models.CharacterObject{
+		ID:        row.ID,
+		Name:      row.Name,
+		Class:     row.Class,
+		DeletedAt: deletedAt(db.deletedCharacters, row.ID),
+	}
+
+	if species, ok := db.species[row.Species]; ok {
+		character.Species = &models.SpeciesObject{ID: species.ID, Name: species.Name}
+	}
+
+	if gender, ok := db.genders[row.Gender]; ok {
+		character.Gender = &models.GenderObject{ID: gender.ID, Name: gender.Name}
+	}
+
+	return character
+}
+
+// deletedAt returns when a record was deleted, or nil if it hasn't been
+func deletedAt(deleted map[int]time.Time, id int) *time.Time {
+	if at, ok := deleted[id]; ok {
+		return &at
+	}
+
+	return nil
+}
+
+// exists reports whether a record is in table and hasn't been deleted
+func exists[T any](table map[int]T, deleted map[int]time.Time, id int) bool {
+	_, ok := table[id]
+	_, isDeleted := deleted[id]
+
+	return ok && !isDeleted
+}
+
+// markDeleted soft deletes a record of table
+func markDeleted[T any](table map[int]T, deleted map[int]time.Time, id int) error {
+	if !exists(table, deleted, id) {
+		return ErrNotFound
+	}
+
+	deleted[id] = time.Now().UTC()
+	return nil
+}
+
+// markDeletedReferenced soft deletes a record of table that characters refer to
+// through the field returned by reference, applying the reference policy in
+// opts. A reference of 0 is treated as null. The caller must hold the lock.
+func markDeletedReferenced[T any](db *memoryDB, table map[int]T, deleted map[int]time.Time, resource string, id int, opts DeleteOptions, reference func(*models.Character) *int) error {
+	if !exists(table, deleted, id) {
+		return ErrNotFound
+	}
+
+	ids := []int{}
+
+	// Deleted characters are changed too, so restoring one doesn't bring back
+	// the reference, but they don't stop the delete
+	referencing := []int{}
+
+	for _, characterID := range sortedIDs(db.characters) {
+		character := db.characters[characterID]
+
+		if *reference(&character) != id {
+			continue
+		}
+
+		referencing = append(referencing, characterID)
+
+		if exists(db.characters, db.deletedCharacters, characterID) {
+			ids = append(ids, characterID)
+		}
+	}
+
+	replacement := 0
+
+	switch opts.Policy {
+	case Restrict, "":
+		if len(ids) > 0 {
+			return &ReferencedError{Resource: resource, ID: id, CharacterIDs: ids}
+		}
+	case Nullify:
+	case Reassign:
+		if opts.ReplacementID == id || !exists(table, deleted, opts.ReplacementID) {
+			return ErrInvalidReplacement
+		}
+
+		replacement = opts.ReplacementID
+	default:
+		return fmt.Errorf("unknown reference policy %q", opts.Policy)
+	}
+
+	for _, characterID := range referencing {
+		character := db.characters[characterID]
+		*reference(&character) = replacement
+		db.characters[characterID] = character
+	}
+
+	return markDeleted(table, deleted, id)
+}
+
+// unmarkDeleted restores a soft deleted record
+func unmarkDeleted(deleted map[int]time.Time, id int) error {
+	if _, ok := deleted[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(deleted, id)
+	return nil
+}
+
+// sortedIDs returns the keys of a table in ascending order
+func sortedIDs[T any](table map[int]T) []int {
+	ids := make([]int, 0, len(table))
+
+	for id := range table {
+		ids = append(ids, id)
+	}
+
+	sort.Ints(ids)
+	return ids
+}
+
+// paginate returns the page of rows described by opts, from sorted rows
+func paginate[T any](rows []T, id func(T) int, opts ListOptions) []T {
+	page := []T{}
+
+	for _, row := range rows {
+		if opts.After > 0 && id(row) <= opts.After {
+			continue
+		}
+
+		if opts.Before > 0 && id(row) >= opts.Before {
+			continue
+		}
+
+		page = append(page, row)
+	}
+
+	// Pages before a cursor are read backwards from it, like in SQL
+	if opts.Before > 0 {
+		reverse(page)
+	}
+
+	if opts.Offset >= len(page) {
+		page = page[:0]
+	} else {
+		page = page[opts.Offset:]
+	}
+
+	if opts.Limit > 0 && opts.Limit < len(page) {
+		page = page[:opts.Limit]
+	}
+
+	if opts.Before > 0 {
+		reverse(page)
+	}
+
+	return page
+}
+
+// sortRows orders rows by the given fields, keeping their existing order by
+// ID for rows that compare equal. keys maps each sortable field to a function
+// returning its sort key, either an int or a lowercased string.
+func sortRows[T any](rows []T, fields []SortField, keys map[string]func(T) any) error {
+	for _, field := range fields {
+		if _, ok := keys[field.Field]; !ok {
+			return fmt.Errorf("unknown sort field %q", field.Field)
+		}
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, field := range fields {
+			key := keys[field.Field]
+			order := compareKeys(key(rows[i]), key(rows[j]))
+
+			if order == 0 {
+				continue
+			}
+
+			if field.Descending {
+				return order > 0
+			}
+
+			return order < 0
+		}
+
+		return false
+	})
+
+	return nil
+}
+
+// compareKeys compares two sort keys of the same type
+func compareKeys(a, b any) int {
+	switch a := a.(type) {
+	case int:
+		return a - b.(int)
+	case string:
+		return strings.Compare(a, b.(string))
+	default:
+		return 0
+	}
+}
+
+// characterSortKeys returns the keys characters can be sorted by. Missing
+// species and genders sort first, like NULLs in SQL.
+var characterSortKeys = map[string]func(models.CharacterObject) any{
+	"id":    func(c models.CharacterObject) any { return c.ID },
+	"name":  func(c models.CharacterObject) any { return strings.ToLower(c.Name) },
+	"class": func(c models.CharacterObject) any { return strings.ToLower(c.Class) },
+	"species": func(c models.CharacterObject) any {
+		if c.Species == nil {
+			return ""
+		}
+
+		return strings.ToLower(c.Species.Name)
+	},
+	"gender": func(c models.CharacterObject) any {
+		if c.Gender == nil {
+			return ""
+		}
+
+		return strings.ToLower(c.Gender.Name)
+	},
+}
+
+var genderSortKeys = map[string]func(models.Gender) any{
+	"id":   func(g models.Gender) any { return g.ID },
+	"name": func(g models.Gender) any { return strings.ToLower(g.Name) },
+}
+
+var speciesSortKeys = map[string]func(models.Species) any{
+	"id":   func(s models.Species) any { return s.ID },
+	"name": func(s models.Species) any { return strings.ToLower(s.Name) },
+}
+
+type memoryCharacterStore struct {
+	db *memoryDB
+}
+
+func (s *memoryCharacterStore) List(ctx context.Context, filter CharacterFilter, opts ListOptions) ([]models.CharacterObject, int, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	characters := []models.CharacterObject{}
+
+	for _, id := range sortedIDs(s.db.characters) {
+		if !opts.IncludeDeleted && !exists(s.db.characters, s.db.deletedCharacters, id) {
+			continue
+		}
+
+		row := s.db.characters[id]
+		character := s.db.joinCharacter(row)
+
+		if !matchesFilter(row, character, filter) {
+			continue
+		}
+
+		characters = append(characters, character)
+	}
+
+	if err := sortRows(characters, opts.Sort, characterSortKeys); err != nil {
+		return nil, 0, err
+	}
+
+	page := paginate(characters, func(c models.CharacterObject) int { return c.ID }, opts)
+
+	return page, len(characters), nil
+}
+
+// matchesFilter reports whether a character and its joined species and gender match filter
+func matchesFilter(row models.Character, character models.CharacterObject, filter CharacterFilter) bool {
+	if filter.SpeciesID > 0 && row.Species != filter.SpeciesID {
+		return false
+	}
+
+	if filter.SpeciesName != "" && (character.Species == nil || !strings.EqualFold(character.Species.Name, filter.SpeciesName)) {
+		return false
+	}
+
+	if filter.GenderID > 0 && row.Gender != filter.GenderID {
+		return false
+	}
+
+	if filter.GenderName != "" && (character.Gender == nil || !strings.EqualFold(character.Gender.Name, filter.GenderName)) {
+		return false
+	}
+
+	return filter.Class == "" || strings.EqualFold(row.Class, filter.Class)
+}
+
+func (s *memoryCharacterStore) Get(ctx context.Context, id int) (*models.CharacterObject, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	if !exists(s.db.characters, s.db.deletedCharacters, id) {
+		return nil, ErrNotFound
+	}
+
+	row := s.db.characters[id]
+
+	character := s.db.joinCharacter(row)
+	return &character, nil
+}
+
+func (s *memoryCharacterStore) Create(ctx context.Context, character *models.Character) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.checkReferences(character); err != nil {
+		return err
+	}
+
+	s.db.lastCharacterID++
+	character.ID = s.db.lastCharacterID
+	s.db.characters[character.ID] = *character
+
+	return nil
+}
+
+func (s *memoryCharacterStore) Update(ctx context.Context, id int, character *models.Character) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !exists(s.db.characters, s.db.deletedCharacters, id) {
+		return ErrNotFound
+	}
+
+	if err := s.db.checkReferences(character); err != nil {
+		return err
+	}
+
+	updated := *character
+	updated.ID = id
+	s.db.characters[id] = updated
+
+	return nil
+}
+
+func (s *memoryCharacterStore) Delete(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return markDeleted(s.db.characters, s.db.deletedCharacters, id)
+}
+
+// Restore restores a deleted character. References to a species or gender
+// that has been deleted since are cleared, as with references=nullify.
+func (s *memoryCharacterStore) Restore(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := unmarkDeleted(s.db.deletedCharacters, id); err != nil {
+		return err
+	}
+
+	character := s.db.characters[id]
+
+	if !exists(s.db.species, s.db.deletedSpecies, character.Species) {
+		character.Species = 0
+	}
+
+	if !exists(s.db.genders, s.db.deletedGenders, character.Gender) {
+		character.Gender = 0
+	}
+
+	s.db.characters[id] = character
+	return nil
+}
+
+type memoryGenderStore struct {
+	db *memoryDB
+}
+
+func (s *memoryGenderStore) List(ctx context.Context, opts ListOptions) ([]models.Gender, int, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	genders := []models.Gender{}
+
+	for _, id := range sortedIDs(s.db.genders) {
+		if !opts.IncludeDeleted && !exists(s.db.genders, s.db.deletedGenders, id) {
+			continue
+		}
+
+		gender := s.db.genders[id]
+		gender.DeletedAt = deletedAt(s.db.deletedGenders, id)
+		genders = append(genders, gender)
+	}
+
+	if err := sortRows(genders, opts.Sort, genderSortKeys); err != nil {
+		return nil, 0, err
+	}
+
+	page := paginate(genders, func(g models.Gender) int { return g.ID }, opts)
+
+	return page, len(genders), nil
+}
+
+func (s *memoryGenderStore) Get(ctx context.Context, id int) (*models.Gender, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	if !exists(s.db.genders, s.db.deletedGenders, id) {
+		return nil, ErrNotFound
+	}
+
+	gender := s.db.genders[id]
+	return &gender, nil
+}
+
+func (s *memoryGenderStore) Create(ctx context.Context, gender *models.Gender) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.lastGenderID++
+	gender.ID = s.db.lastGenderID
+
+	// Only Delete can set when a record was deleted
+	created := *gender
+	created.DeletedAt = nil
+	s.db.genders[gender.ID] = created
+
+	return nil
+}
+
+func (s *memoryGenderStore) Update(ctx context.Context, id int, gender *models.Gender) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !exists(s.db.genders, s.db.deletedGenders, id) {
+		return ErrNotFound
+	}
+
+	updated := *gender
+	updated.ID = id
+	updated.DeletedAt = nil
+	s.db.genders[id] = updated
+
+	return nil
+}
+
+func (s *memoryGenderStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return markDeletedReferenced(s.db, s.db.genders, s.db.deletedGenders, ResourceGenders, id, opts, func(character *models.Character) *int {
+		return &character.Gender
+	})
+}
+
+func (s *memoryGenderStore) Restore(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return unmarkDeleted(s.db.deletedGenders, id)
+}
+
+type memorySpeciesStore struct {
+	db *memoryDB
+}
+
+func (s *memorySpeciesStore) List(ctx context.Context, opts ListOptions) ([]models.Species, int, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	speciesList := []models.Species{}
+
+	for _, id := range sortedIDs(s.db.species) {
+		if !opts.IncludeDeleted && !exists(s.db.species, s.db.deletedSpecies, id) {
+			continue
+		}
+
+		species := s.db.species[id]
+		species.DeletedAt = deletedAt(s.db.deletedSpecies, id)
+		speciesList = append(speciesList, species)
+	}
+
+	if err := sortRows(speciesList, opts.Sort, speciesSortKeys); err != nil {
+		return nil, 0, err
+	}
+
+	page := paginate(speciesList, func(species models.Species) int { return species.ID }, opts)
+
+	return page, len(speciesList), nil
+}
+
+func (s *memorySpeciesStore) Get(ctx context.Context, id int) (*models.Species, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	if !exists(s.db.species, s.db.deletedSpecies, id) {
+		return nil, ErrNotFound
+	}
+
+	species := s.db.species[id]
+	return &species, nil
+}
+
+func (s *memorySpeciesStore) Create(ctx context.Context, species *models.Species) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.lastSpeciesID++
+	species.ID = s.db.lastSpeciesID
+
+	// Only Delete can set when a record was deleted
+	created := *species
+	created.DeletedAt = nil
+	s.db.species[species.ID] = created
+
+	return nil
+}
+
+func (s *memorySpeciesStore) Update(ctx context.Context, id int, species *models.Species) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if !exists(s.db.species, s.db.deletedSpecies, id) {
+		return ErrNotFound
+	}
+
+	updated := *species
+	updated.ID = id
+	updated.DeletedAt = nil
+	s.db.species[id] = updated
+
+	return nil
+}
+
+func (s *memorySpeciesStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return markDeletedReferenced(s.db, s.db.species, s.db.deletedSpecies, ResourceSpecies, id, opts, func(character *models.Character) *int {
+		return &character.Species
+	})
+}
+
+func (s *memorySpeciesStore) Restore(ctx context.Context, id int) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return unmarkDeleted(s.db.deletedSpecies, id)
+}
+
+// auditSortKeys maps the fields audit entries can be sorted by to their keys
+var auditSortKeys = map[string]func(models.AuditEntry) any{
+	"id": func(e models.AuditEntry) any { return e.ID },
+}
+
+type memoryAuditStore struct {
+	mu      sync.RWMutex
+	entries []models.AuditEntry
+}
+
+func (s *memoryAuditStore) Record(ctx context.Context, entry *models.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = len(s.entries) + 1
+	s.entries = append(s.entries, *entry)
+
+	return nil
+}
+
+func (s *memoryAuditStore) List(ctx context.Context, filter AuditFilter, opts ListOptions) ([]models.AuditEntry, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := []models.AuditEntry{}
+
+	for _, entry := range s.entries {
+		if matchesAuditFilter(entry, filter) {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := sortRows(entries, opts.Sort, auditSortKeys); err != nil {
+		return nil, 0, err
+	}
+
+	page := paginate(entries, func(e models.AuditEntry) int { return e.ID }, opts)
+
+	return page, len(entries), nil
+}
+
+// matchesAuditFilter reports whether an entry matches every field set in filter
+func matchesAuditFilter(entry models.AuditEntry, filter AuditFilter) bool {
+	switch {
+	case filter.Resource != "" && entry.Resource != filter.Resource:
+		return false
+	case filter.ResourceID > 0 && entry.ResourceID != filter.ResourceID:
+		return false
+	case filter.Actor != "" && entry.Actor != filter.Actor:
+		return false
+	case !filter.Since.IsZero() && entry.Time.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && !entry.Time.Before(filter.Until):
+		return false
+	default:
+		return true
+	}
+}
+
+// revisionSortKeys maps the fields revisions can be sorted by to their keys
+var revisionSortKeys = map[string]func(models.Revision) any{
+	"revision": func(r models.Revision) any { return r.Revision },
+}
+
+// revisionKey identifies the record a revision belongs to
+type revisionKey struct {
+	resource string
+	id       int
+}
+
+func copyRevisions(revisions map[revisionKey][]models.Revision) map[revisionKey][]models.Revision {
+	copied := make(map[revisionKey][]models.Revision, len(revisions))
+
+	for key, list := range revisions {
+		copied[key] = append([]models.Revision{}, list...)
+	}
+
+	return copied
+}
+
+type memoryRevisionStore struct {
+	mu        sync.RWMutex
+	revisions map[revisionKey][]models.Revision
+}
+
+func (s *memoryRevisionStore) Record(ctx context.Context, revision *models.Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := revisionKey{revision.Resource, revision.ResourceID}
+
+	revision.Revision = len(s.revisions[key]) + 1
+	s.revisions[key] = append(s.revisions[key], *revision)
+
+	return nil
+}
+
+func (s *memoryRevisionStore) List(ctx context.Context, resource string, id int, opts ListOptions) ([]models.Revision, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := append([]models.Revision{}, s.revisions[revisionKey{resource, id}]...)
+
+	if err := sortRows(revisions, opts.Sort, revisionSortKeys); err != nil {
+		return nil, 0, err
+	}
+
+	page := paginate(revisions, func(r models.Revision) int { return r.Revision }, opts)
+
+	return page, len(revisions), nil
+}
+
+func (s *memoryRevisionStore) Get(ctx context.Context, resource string, id int, revision int) (*models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := s.revisions[revisionKey{resource, id}]
+
+	if revision < 1 || revision > len(revisions) {
+		return nil, ErrNotFound
+	}
+
+	result := revisions[revision-1]
+	return &result, nil
+}
+
+func (s *memoryRevisionStore) AsOf(ctx context.Context, t time.Time) ([]models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	latest := []models.Revision{}
+
+	for _, revisions := range s.revisions {
+		// Revisions are recorded in order, so the last one made by t is the latest
+		for i := len(revisions) - 1; i >= 0; i-- {
+			if !revisions[i].Time.After(t) {
+				latest = append(latest, revisions[i])
+				break
+			}
+		}
+	}
+
+	sort.Slice(latest, func(i, j int) bool {
+		if latest[i].Resource != latest[j].Resource {
+			return latest[i].Resource < latest[j].Resource
+		}
+
+		return latest[i].ResourceID < latest[j].ResourceID
+	})
+
+	return latest, nil
+}
@@ -0,0 +1,941 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/njwong/me-api/models"
+)
+
+// NewSQL creates a store backed by the given database connection. Queries
+// are written to run unchanged on both MySQL and SQLite.
+func NewSQL(db *sql.DB) *Store {
+	return newSQLStore(newStatements(db))
+}
+
+// newSQLStore creates a store that runs its queries with db, which may be
+// bound to a transaction
+func newSQLStore(db queryer) *Store {
+	return &Store{
+		Characters: &sqlCharacterStore{db: db},
+		Genders:    &sqlGenderStore{db: db},
+		Species:    &sqlSpeciesStore{db: db},
+		Audit:      &sqlAuditStore{db: db},
+		Revisions:  &sqlRevisionStore{db: db},
+
+		transaction: func(ctx context.Context, fn func(tx *Store) error) error {
+			return db.transaction(ctx, func(tx queryer) error {
+				return fn(newSQLStore(tx))
+			})
+		},
+	}
+}
+
+// characterSortColumns maps the fields characters can be sorted by to SQL.
+// Text is compared case-insensitively to match the in-memory store.
+var characterSortColumns = map[string]string{
+	"id":      "characters.id",
+	"name":    "LOWER(characters.name)",
+	"class":   "LOWER(characters.class)",
+	"species": "LOWER(species.name)",
+	"gender":  "LOWER(genders.name)",
+}
+
+// nameSortColumns maps the fields genders and species can be sorted by to SQL
+var nameSortColumns = map[string]string{
+	"id":   "id",
+	"name": "LOWER(name)",
+}
+
+// characterJoins joins characters to their species and gender. Characters
+// whose species or gender no longer exists are still returned.
+const characterJoins = " FROM characters LEFT JOIN species ON characters.species = species.id LEFT JOIN genders ON characters.gender = genders.id"
+
+// selectCharacters selects characters along with their species and gender
+const selectCharacters = "SELECT characters.id, characters.name, characters.class, characters.deleted_at, species.id, species.name, genders.id, genders.name" + characterJoins
+
+type sqlCharacterStore struct {
+	db queryer
+}
+
+func (s *sqlCharacterStore) List(ctx context.Context, filter CharacterFilter, opts ListOptions) ([]models.CharacterObject, int, error) {
+	conditions, args := characterConditions(filter)
+	conditions = notDeleted("characters.deleted_at", opts, conditions)
+
+	total, err := count(ctx, s.db, "SELECT COUNT(*)"+characterJoins+where(conditions), args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clauses, args, err := pageClauses("characters.id", characterSortColumns, opts, conditions, args)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := selectCharacters + clauses
+
+	res, err := s.db.query(ctx, query, args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer res.Close()
+
+	characters := []models.CharacterObject{}
+
+	for res.Next() {
+		character, err := scanCharacter(res)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		characters = append(characters, *character)
+	}
+
+	if opts.Before > 0 {
+		reverse(characters)
+	}
+
+	return characters, total, res.Err()
+}
+
+// characterConditions builds the WHERE conditions matching filter
+func characterConditions(filter CharacterFilter) ([]string, []any) {
+	conditions := []string{}
+	args := []any{}
+
+	if filter.SpeciesID > 0 {
+		conditions = append(conditions, "characters.species = ?")
+		args = append(args, filter.SpeciesID)
+	}
+
+	if filter.SpeciesName != "" {
+		conditions = append(conditions, "LOWER(species.name) = LOWER(?)")
+		args = append(args, filter.SpeciesName)
+	}
+
+	if filter.GenderID > 0 {
+		conditions = append(conditions, "characters.gender = ?")
+		args = append(args, filter.GenderID)
+	}
+
+	if filter.GenderName != "" {
+		conditions = append(conditions, "LOWER(genders.name) = LOWER(?)")
+		args = append(args, filter.GenderName)
+	}
+
+	if filter.Class != "" {
+		conditions = append(conditions, "LOWER(characters.class) = LOWER(?)")
+		args = append(args, filter.Class)
+	}
+
+	return conditions, args
+}
+
+func (s *sqlCharacterStore) Get(ctx context.Context, id int) (*models.CharacterObject, error) {
+	if err := s.db.lockRow(ctx, "characters", id); err != nil {
+		return nil, err
+	}
+
+	row := s.db.queryRow(ctx, selectCharacters+" WHERE characters.id = ? AND characters.deleted_at IS NULL", id)
+
+	character, err := scanCharacter(row)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return character, err
+}
+
+// scanCharacter reads a row selected by selectCharacters
+func scanCharacter(row rowScanner) (*models.CharacterObject, error) {
+	var character models.CharacterObject
+	var deletedAt sql.NullTime
+	var speciesID sql.NullInt64
+	var speciesName sql.NullString
+	var genderID sql.NullInt64
+	var genderName sql.NullString
+
+	err := row.Scan(&character.ID, &character.Name, &character.Class, &deletedAt, &speciesID, &speciesName, &genderID, &genderName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if deletedAt.Valid {
+		character.DeletedAt = &deletedAt.Time
+	}
+
+	if speciesID.Valid {
+		character.Species = &models.SpeciesObject{
+			ID:   int(speciesID.Int64),
+			Name: speciesName.String,
+		}
+	}
+
+	if genderID.Valid {
+		character.Gender = &models.GenderObject{
+			ID:   int(genderID.Int64),
+			Name: genderName.String,
+		}
+	}
+
+	return &character, nil
+}
+
+func (s *sqlCharacterStore) Create(ctx context.Context, character *models.Character) error {
+	return s.db.transaction(ctx, func(tx queryer) error {
+		if err := checkReferences(ctx, tx, character); err != nil {
+			return err
+		}
+
+		query := "INSERT INTO characters (name, species, gender, class) VALUES (?, ?, ?, ?)"
+
+		id, err := execInsert(ctx, tx, query, character.Name, nullableID(character.Species), nullableID(character.Gender), character.Class)
+
+		if err != nil {
+			return err
+		}
+
+		character.ID = id
+		return nil
+	})
+}
+
+func (s *sqlCharacterStore) Update(ctx context.Context, id int, character *models.Character) error {
+	return s.db.transaction(ctx, func(tx queryer) error {
+		if err := checkReferences(ctx, tx, character); err != nil {
+			return err
+		}
+
+		query := "UPDATE characters SET name = ?, species = ?, gender = ?, class = ? WHERE id = ? AND deleted_at IS NULL"
+
+		return execAffectingRow(ctx, tx, query, character.Name, nullableID(character.Species), nullableID(character.Gender), character.Class, id)
+	})
+}
+
+// checkReferences returns a MissingReferenceError if the character's species
+// or gender doesn't exist or has been deleted. Their rows are locked, so they
+// can't be deleted before the character is written.
+func checkReferences(ctx context.Context, tx queryer, character *models.Character) error {
+	references := []struct {
+		field, table string
+		id           int
+	}{
+		{"species", "species", character.Species},
+		{"gender", "genders", character.Gender},
+	}
+
+	for _, reference := range references {
+		if reference.id == 0 {
+			continue
+		}
+
+		if err := tx.lockRow(ctx, reference.table, reference.id); err != nil {
+			return err
+		}
+
+		n, err := count(ctx, tx, "SELECT COUNT(*) FROM "+reference.table+" WHERE id = ? AND deleted_at IS NULL", reference.id)
+
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return &MissingReferenceError{Field: reference.field, ID: reference.id}
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlCharacterStore) Delete(ctx context.Context, id int) error {
+	return softDelete(ctx, s.db, "characters", id)
+}
+
+// Restore restores a deleted character. References to a species or gender
+// that has been deleted since are cleared, as with references=nullify.
+func (s *sqlCharacterStore) Restore(ctx context.Context, id int) error {
+	return s.db.transaction(ctx, func(tx queryer) error {
+		if err := restore(ctx, tx, "characters", id); err != nil {
+			return err
+		}
+
+		for column, table := range map[string]string{"species": "species", "gender": "genders"} {
+			query := "UPDATE characters SET " + column + " = NULL WHERE id = ? AND " + column +
+				" NOT IN (SELECT id FROM " + table + " WHERE deleted_at IS NULL)"
+
+			if _, err := tx.exec(ctx, query, id); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+type sqlGenderStore struct {
+	db queryer
+}
+
+func (s *sqlGenderStore) List(ctx context.Context, opts ListOptions) ([]models.Gender, int, error) {
+	conditions := notDeleted("deleted_at", opts, nil)
+
+	total, err := count(ctx, s.db, "SELECT COUNT(*) FROM genders"+where(conditions))
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clauses, args, err := pageClauses("id", nameSortColumns, opts, conditions, nil)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := s.db.query(ctx, "SELECT id, name, deleted_at FROM genders"+clauses, args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer res.Close()
+
+	genders := []models.Gender{}
+
+	for res.Next() {
+		var gender models.Gender
+		var deletedAt sql.NullTime
+
+		if err := res.Scan(&gender.ID, &gender.Name, &deletedAt); err != nil {
+			return nil, 0, err
+		}
+
+		if deletedAt.Valid {
+			gender.DeletedAt = &deletedAt.Time
+		}
+
+		genders = append(genders, gender)
+	}
+
+	if opts.Before > 0 {
+		reverse(genders)
+	}
+
+	return genders, total, res.Err()
+}
+
+func (s *sqlGenderStore) Get(ctx context.Context, id int) (*models.Gender, error) {
+	var gender models.Gender
+
+	if err := s.db.lockRow(ctx, "genders", id); err != nil {
+		return nil, err
+	}
+
+	err := s.db.queryRow(ctx, "SELECT id, name FROM genders WHERE id = ? AND deleted_at IS NULL", id).Scan(&gender.ID, &gender.Name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return &gender, err
+}
+
+func (s *sqlGenderStore) Create(ctx context.Context, gender *models.Gender) error {
+	id, err := execInsert(ctx, s.db, "INSERT INTO genders (name) VALUES (?)", gender.Name)
+
+	if err != nil {
+		return err
+	}
+
+	gender.ID = id
+	return nil
+}
+
+func (s *sqlGenderStore) Update(ctx context.Context, id int, gender *models.Gender) error {
+	return execAffectingRow(ctx, s.db, "UPDATE genders SET name = ? WHERE id = ? AND deleted_at IS NULL", gender.Name, id)
+}
+
+func (s *sqlGenderStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	return softDeleteReferenced(ctx, s.db, "genders", "gender", id, opts)
+}
+
+func (s *sqlGenderStore) Restore(ctx context.Context, id int) error {
+	return restore(ctx, s.db, "genders", id)
+}
+
+type sqlSpeciesStore struct {
+	db queryer
+}
+
+func (s *sqlSpeciesStore) List(ctx context.Context, opts ListOptions) ([]models.Species, int, error) {
+	conditions := notDeleted("deleted_at", opts, nil)
+
+	total, err := count(ctx, s.db, "SELECT COUNT(*) FROM species"+where(conditions))
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clauses, args, err := pageClauses("id", nameSortColumns, opts, conditions, nil)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, err := s.db.query(ctx, "SELECT id, name, deleted_at FROM species"+clauses, args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer res.Close()
+
+	speciesList := []models.Species{}
+
+	for res.Next() {
+		var species models.Species
+		var deletedAt sql.NullTime
+
+		if err := res.Scan(&species.ID, &species.Name, &deletedAt); err != nil {
+			return nil, 0, err
+		}
+
+		if deletedAt.Valid {
+			species.DeletedAt = &deletedAt.Time
+		}
+
+		speciesList = append(speciesList, species)
+	}
+
+	if opts.Before > 0 {
+		reverse(speciesList)
+	}
+
+	return speciesList, total, res.Err()
+}
+
+func (s *sqlSpeciesStore) Get(ctx context.Context, id int) (*models.Species, error) {
+	var species models.Species
+
+	if err := s.db.lockRow(ctx, "species", id); err != nil {
+		return nil, err
+	}
+
+	err := s.db.queryRow(ctx, "SELECT id, name FROM species WHERE id = ? AND deleted_at IS NULL", id).Scan(&species.ID, &species.Name)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return &species, err
+}
+
+func (s *sqlSpeciesStore) Create(ctx context.Context, species *models.Species) error {
+	id, err := execInsert(ctx, s.db, "INSERT INTO species (name) VALUES (?)", species.Name)
+
+	if err != nil {
+		return err
+	}
+
+	species.ID = id
+	return nil
+}
+
+func (s *sqlSpeciesStore) Update(ctx context.Context, id int, species *models.Species) error {
+	return execAffectingRow(ctx, s.db, "UPDATE species SET name = ? WHERE id = ? AND deleted_at IS NULL", species.Name, id)
+}
+
+func (s *sqlSpeciesStore) Delete(ctx context.Context, id int, opts DeleteOptions) error {
+	return softDeleteReferenced(ctx, s.db, "species", "species", id, opts)
+}
+
+func (s *sqlSpeciesStore) Restore(ctx context.Context, id int) error {
+	return restore(ctx, s.db, "species", id)
+}
+
+// auditSortColumns maps the fields audit entries can be sorted by to SQL
+var auditSortColumns = map[string]string{
+	"id": "id",
+}
+
+type sqlAuditStore struct {
+	db queryer
+}
+
+func (s *sqlAuditStore) Record(ctx context.Context, entry *models.AuditEntry) error {
+	query := "INSERT INTO audit_log (created_at, actor, request_id, action, resource, resource_id, before_state, after_state, changes) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+	id, err := execInsert(ctx, s.db, query,
+		entry.Time, entry.Actor, entry.RequestID, entry.Action, entry.Resource, entry.ResourceID,
+		nullJSON(entry.Before), nullJSON(entry.After), nullJSON(entry.Changes),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	entry.ID = id
+	return nil
+}
+
+func (s *sqlAuditStore) List(ctx context.Context, filter AuditFilter, opts ListOptions) ([]models.AuditEntry, int, error) {
+	conditions := []string{}
+	args := []any{}
+
+	if filter.Resource != "" {
+		conditions = append(conditions, "resource = ?")
+		args = append(args, filter.Resource)
+	}
+
+	if filter.ResourceID > 0 {
+		conditions = append(conditions, "resource_id = ?")
+		args = append(args, filter.ResourceID)
+	}
+
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	total, err := count(ctx, s.db, "SELECT COUNT(*) FROM audit_log"+where(conditions), args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clauses, args, err := pageClauses("id", auditSortColumns, opts, conditions, args)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT id, created_at, actor, request_id, action, resource, resource_id, before_state, after_state, changes FROM audit_log" + clauses
+
+	res, err := s.db.query(ctx, query, args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer res.Close()
+
+	entries := []models.AuditEntry{}
+
+	for res.Next() {
+		var entry models.AuditEntry
+		var before, after, changes sql.NullString
+
+		err := res.Scan(&entry.ID, &entry.Time, &entry.Actor, &entry.RequestID, &entry.Action,
+			&entry.Resource, &entry.ResourceID, &before, &after, &changes)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		entry.Time = entry.Time.UTC()
+		entry.Before = rawJSON(before)
+		entry.After = rawJSON(after)
+		entry.Changes = rawJSON(changes)
+
+		entries = append(entries, entry)
+	}
+
+	if opts.Before > 0 {
+		reverse(entries)
+	}
+
+	return entries, total, res.Err()
+}
+
+// revisionSortColumns maps the fields revisions can be sorted by to SQL
+var revisionSortColumns = map[string]string{
+	"revision": "revision",
+}
+
+const selectRevisions = "SELECT resource, resource_id, revision, created_at, action, record, deleted FROM revisions"
+
+type sqlRevisionStore struct {
+	db queryer
+}
+
+// Record adds the next revision of a record. The record's row is locked
+// first, as the write being recorded has done already, so that concurrent
+// writes to it are numbered one after the other. The number is worked out
+// by the insert itself, which reads the latest revision even where the
+// transaction's other reads see an earlier snapshot.
+func (s *sqlRevisionStore) Record(ctx context.Context, revision *models.Revision) error {
+	return s.db.transaction(ctx, func(tx queryer) error {
+		if err := tx.lockRow(ctx, revision.Resource, revision.ResourceID); err != nil {
+			return err
+		}
+
+		query := "INSERT INTO revisions (resource, resource_id, revision, created_at, action, record, deleted) " +
+			"SELECT ?, ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ? FROM revisions WHERE resource = ? AND resource_id = ?"
+
+		_, err := tx.exec(ctx, query, revision.Resource, revision.ResourceID, revision.Time, revision.Action,
+			string(revision.Record), revision.Deleted, revision.Resource, revision.ResourceID)
+
+		if err != nil {
+			return err
+		}
+
+		query = "SELECT MAX(revision) FROM revisions WHERE resource = ? AND resource_id = ?"
+
+		return tx.queryRow(ctx, query, revision.Resource, revision.ResourceID).Scan(&revision.Revision)
+	})
+}
+
+func (s *sqlRevisionStore) List(ctx context.Context, resource string, id int, opts ListOptions) ([]models.Revision, int, error) {
+	conditions := []string{"resource = ?", "resource_id = ?"}
+	args := []any{resource, id}
+
+	total, err := count(ctx, s.db, "SELECT COUNT(*) FROM revisions"+where(conditions), args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clauses, args, err := pageClauses("revision", revisionSortColumns, opts, conditions, args)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	revisions, err := s.query(ctx, selectRevisions+clauses, args...)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if opts.Before > 0 {
+		reverse(revisions)
+	}
+
+	return revisions, total, nil
+}
+
+func (s *sqlRevisionStore) Get(ctx context.Context, resource string, id int, revision int) (*models.Revision, error) {
+	row := s.db.queryRow(ctx, selectRevisions+" WHERE resource = ? AND resource_id = ? AND revision = ?", resource, id, revision)
+
+	result, err := scanRevision(row)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+
+	return result, err
+}
+
+func (s *sqlRevisionStore) AsOf(ctx context.Context, t time.Time) ([]models.Revision, error) {
+	query := selectRevisions + " WHERE revision = (" +
+		"SELECT MAX(latest.revision) FROM revisions latest" +
+		" WHERE latest.resource = revisions.resource AND latest.resource_id = revisions.resource_id AND latest.created_at <= ?" +
+		") ORDER BY resource, resource_id"
+
+	return s.query(ctx, query, t.UTC())
+}
+
+func (s *sqlRevisionStore) query(ctx context.Context, query string, args ...any) ([]models.Revision, error) {
+	res, err := s.db.query(ctx, query, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Close()
+
+	revisions := []models.Revision{}
+
+	for res.Next() {
+		revision, err := scanRevision(res)
+
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, *revision)
+	}
+
+	return revisions, res.Err()
+}
+
+// scanRevision reads a row selected by selectRevisions
+func scanRevision(row rowScanner) (*models.Revision, error) {
+	var revision models.Revision
+	var record string
+
+	err := row.Scan(&revision.Resource, &revision.ResourceID, &revision.Revision, &revision.Time,
+		&revision.Action, &record, &revision.Deleted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Time = revision.Time.UTC()
+	revision.Record = []byte(record)
+
+	return &revision, nil
+}
+
+// execInsert runs an INSERT statement and returns the ID of the new row
+func execInsert(ctx context.Context, db queryer, query string, args ...any) (int, error) {
+	result, err := db.exec(ctx, query, args...)
+
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+
+	return int(id), err
+}
+
+// execAffectingRow runs a statement and returns ErrNotFound if no rows were affected
+func execAffectingRow(ctx context.Context, db queryer, query string, args ...any) error {
+	result, err := db.exec(ctx, query, args...)
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// nullableID returns the value to write for a reference to another record,
+// which is NULL when id is 0
+func nullableID(id int) any {
+	if id == 0 {
+		return nil
+	}
+
+	return id
+}
+
+// softDelete marks a record of table as deleted
+func softDelete(ctx context.Context, db queryer, table string, id int) error {
+	query := "UPDATE " + table + " SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL"
+
+	return execAffectingRow(ctx, db, query, time.Now().UTC(), id)
+}
+
+// softDeleteReferenced soft deletes a record of table that characters refer to
+// through column, applying the reference policy in opts in one transaction
+func softDeleteReferenced(ctx context.Context, db queryer, table string, column string, id int, opts DeleteOptions) error {
+	return db.transaction(ctx, func(tx queryer) error {
+		found, err := count(ctx, tx, "SELECT COUNT(*) FROM "+table+" WHERE id = ? AND deleted_at IS NULL", id)
+
+		if err != nil {
+			return err
+		}
+
+		if found == 0 {
+			return ErrNotFound
+		}
+
+		switch opts.Policy {
+		case Restrict, "":
+			ids, err := referencingCharacters(ctx, tx, column, id)
+
+			if err != nil {
+				return err
+			}
+
+			if len(ids) > 0 {
+				return &ReferencedError{Resource: table, ID: id, CharacterIDs: ids}
+			}
+		case Nullify:
+			// Deleted characters are changed too, so restoring one doesn't
+			// bring back the reference
+			query := "UPDATE characters SET " + column + " = NULL WHERE " + column + " = ?"
+
+			if _, err := tx.exec(ctx, query, id); err != nil {
+				return err
+			}
+		case Reassign:
+			if opts.ReplacementID == id {
+				return ErrInvalidReplacement
+			}
+
+			found, err := count(ctx, tx, "SELECT COUNT(*) FROM "+table+" WHERE id = ? AND deleted_at IS NULL", opts.ReplacementID)
+
+			if err != nil {
+				return err
+			}
+
+			if found == 0 {
+				return ErrInvalidReplacement
+			}
+
+			query := "UPDATE characters SET " + column + " = ? WHERE " + column + " = ?"
+
+			if _, err := tx.exec(ctx, query, opts.ReplacementID, id); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown reference policy %q", opts.Policy)
+		}
+
+		return softDelete(ctx, tx, table, id)
+	})
+}
+
+// referencingCharacters returns the IDs of the characters that refer to id
+// through column
+func referencingCharacters(ctx context.Context, db queryer, column string, id int) ([]int, error) {
+	rows, err := db.query(ctx, "SELECT id FROM characters WHERE "+column+" = ? AND deleted_at IS NULL ORDER BY id", id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ids := []int{}
+
+	for rows.Next() {
+		var characterID int
+
+		if err := rows.Scan(&characterID); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, characterID)
+	}
+
+	return ids, rows.Err()
+}
+
+// restore undoes softDelete
+func restore(ctx context.Context, db queryer, table string, id int) error {
+	query := "UPDATE " + table + " SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL"
+
+	return execAffectingRow(ctx, db, query, id)
+}
+
+// notDeleted adds a condition leaving out deleted records to conditions,
+// unless opts includes them
+func notDeleted(column string, opts ListOptions, conditions []string) []string {
+	if opts.IncludeDeleted {
+		return conditions
+	}
+
+	return append(conditions, column+" IS NULL")
+}
+
+// count runs a SELECT COUNT(*) query
+func count(ctx context.Context, db queryer, query string, args ...any) (int, error) {
+	var total int
+
+	err := db.queryRow(ctx, query, args...).Scan(&total)
+
+	return total, err
+}
+
+// where joins conditions into a WHERE clause
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// pageClauses adds the cursor conditions for opts to the given ones, and
+// builds the WHERE, ORDER BY and LIMIT clauses selecting the page along with
+// their arguments. sortColumns maps the fields records can be sorted by to
+// the SQL expressions they sort by.
+func pageClauses(idColumn string, sortColumns map[string]string, opts ListOptions, conditions []string, args []any) (string, []any, error) {
+	if opts.After > 0 {
+		conditions = append(conditions, idColumn+" > ?")
+		args = append(args, opts.After)
+	}
+
+	if opts.Before > 0 {
+		conditions = append(conditions, idColumn+" < ?")
+		args = append(args, opts.Before)
+	}
+
+	order := []string{}
+
+	for _, field := range opts.Sort {
+		column, ok := sortColumns[field.Field]
+
+		if !ok {
+			return "", nil, fmt.Errorf("unknown sort field %q", field.Field)
+		}
+
+		if field.Descending {
+			column += " DESC"
+		}
+
+		order = append(order, column)
+	}
+
+	// Pages before a cursor are read backwards from it, then reversed
+	if opts.Before > 0 {
+		order = append(order, idColumn+" DESC")
+	} else {
+		order = append(order, idColumn)
+	}
+
+	clauses := where(conditions) + " ORDER BY " + strings.Join(order, ", ")
+
+	if opts.Limit > 0 || opts.Offset > 0 {
+		limit := opts.Limit
+
+		// Both MySQL and SQLite need a LIMIT to use OFFSET
+		if limit == 0 {
+			limit = math.MaxInt
+		}
+
+		clauses += " LIMIT ? OFFSET ?"
+		args = append(args, limit, opts.Offset)
+	}
+
+	return clauses, args, nil
+}
+
+// nullJSON stores an empty JSON value as NULL
+func nullJSON(value []byte) sql.NullString {
+	return sql.NullString{String: string(value), Valid: len(value) > 0}
+}
+
+// rawJSON undoes nullJSON
+func rawJSON(value sql.NullString) []byte {
+	if !value.Valid {
+		return nil
+	}
+
+	return []byte(value.String)
+}
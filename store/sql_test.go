@@ -0,0 +1,174 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/njwong/me-api/database"
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+)
+
+// newSQLite returns a store backed by a new, migrated SQLite database
+func newSQLite(t *testing.T) *store.Store {
+	t.Helper()
+
+	return store.NewSQL(newSQLiteDB(t))
+}
+
+// newSQLiteDB opens a new, migrated SQLite database
+func newSQLiteDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, dialect, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := database.MigrateUp(db, dialect); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// TestSQLStatementsWithTransactions runs reads that prepare new statements
+// alongside deletes that run in transactions, which used to deadlock on
+// SQLite's single connection
+func TestSQLStatementsWithTransactions(t *testing.T) {
+	s := newSQLite(t)
+	ctx := context.Background()
+
+	species := models.Species{Name: "Krogan"}
+	mustDo(t, s.Species.Create(ctx, &species))
+
+	sorts := [][]store.SortField{}
+
+	for _, field := range []string{"id", "name", "class", "species", "gender"} {
+		for _, other := range []string{"id", "name", "class", "species", "gender"} {
+			sorts = append(sorts, []store.SortField{{Field: field}, {Field: other, Descending: true}})
+		}
+	}
+
+	genders := []int{}
+
+	for i := range sorts {
+		gender := models.Gender{Name: fmt.Sprint("Gender ", i)}
+		mustDo(t, s.Genders.Create(ctx, &gender))
+
+		character := models.Character{Name: fmt.Sprint("Character ", i), Species: species.ID, Gender: gender.ID}
+		mustDo(t, s.Characters.Create(ctx, &character))
+
+		genders = append(genders, gender.ID)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		var wg sync.WaitGroup
+
+		for i, sort := range sorts {
+			wg.Add(2)
+
+			go func(sort []store.SortField) {
+				defer wg.Done()
+
+				for limit := 1; limit < 4; limit++ {
+					if _, _, err := s.Characters.List(ctx, store.CharacterFilter{Class: fmt.Sprint(limit)}, store.ListOptions{Sort: sort, Limit: limit}); err != nil {
+						t.Error(err)
+					}
+				}
+			}(sort)
+
+			go func(id int) {
+				defer wg.Done()
+
+				if err := s.Genders.Delete(ctx, id, store.DeleteOptions{Policy: store.Nullify}); err != nil {
+					t.Error(err)
+				}
+			}(genders[i])
+		}
+
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("deadlocked")
+	}
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSQLTransactionGetLocks checks that a record read in one transaction
+// can't be read in another until the first has written it and committed.
+// On SQLite the second transaction waits for the only connection, while
+// TestLockRow checks the lock itself.
+func TestSQLTransactionGetLocks(t *testing.T) {
+	s := newSQLite(t)
+	ctx := context.Background()
+
+	gender := models.Gender{Name: "Female"}
+	mustDo(t, s.Genders.Create(ctx, &gender))
+
+	locked := make(chan struct{})
+	read := make(chan string, 1)
+	done := make(chan error)
+
+	// Start the second transaction once the first holds the lock, as it can
+	// otherwise take SQLite's only connection first
+	go func() {
+		<-locked
+
+		done <- s.Transaction(ctx, func(tx *store.Store) error {
+			current, err := tx.Genders.Get(ctx, gender.ID)
+
+			if err != nil {
+				return err
+			}
+
+			read <- current.Name
+			return nil
+		})
+	}()
+
+	err := s.Transaction(ctx, func(tx *store.Store) error {
+		if _, err := tx.Genders.Get(ctx, gender.ID); err != nil {
+			return err
+		}
+
+		close(locked)
+
+		select {
+		case name := <-read:
+			t.Errorf("second transaction read %q before the update", name)
+		default:
+		}
+
+		return tx.Genders.Update(ctx, gender.ID, &models.Gender{Name: "Male"})
+	})
+
+	mustDo(t, err)
+	mustDo(t, <-done)
+
+	if name := <-read; name != "Male" {
+		t.Errorf("second transaction read %q, want %q", name, "Male")
+	}
+}
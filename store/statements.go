@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// maxCachedStatements bounds the statement cache. List queries are built
+// from the filters and sort fields of each request, so the number of
+// distinct queries isn't fixed.
+const maxCachedStatements = 128
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// errRow is a rowScanner for a query that failed before it could run
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
+
+// queryer runs queries, either directly or within a transaction
+type queryer interface {
+	exec(ctx context.Context, query string, args ...any) (sql.Result, error)
+	query(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	queryRow(ctx context.Context, query string, args ...any) rowScanner
+
+	// transaction runs fn in a transaction, or as part of the current one
+	transaction(ctx context.Context, fn func(tx queryer) error) error
+
+	// lockRow locks a row of table until the end of the transaction, so it
+	// can be read and then written without another writer in between.
+	// Outside a transaction it does nothing.
+	lockRow(ctx context.Context, table string, id int) error
+}
+
+// statements runs parameterized queries, preparing each distinct query once
+// and reusing the prepared statement for later calls. Values are always
+// passed as arguments rather than formatted into the SQL.
+type statements struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	cache map[string]*sql.Stmt
+}
+
+func newStatements(db *sql.DB) *statements {
+	return &statements{db: db, cache: map[string]*sql.Stmt{}}
+}
+
+// prepare returns the cached statement for query, preparing it if needed.
+// Once the cache is full, new queries are prepared for a single use and
+// close must be called on them afterwards. The lock isn't held while
+// preparing, as that may wait for a connection held by a transaction which
+// needs the lock to look up its own statements.
+func (s *statements) prepare(ctx context.Context, query string) (stmt *sql.Stmt, cached bool, err error) {
+	s.mu.Lock()
+	stmt, ok := s.cache[query]
+	full := len(s.cache) >= maxCachedStatements
+	s.mu.Unlock()
+
+	if ok {
+		return stmt, true, nil
+	}
+
+	if full {
+		stmt, err = s.db.PrepareContext(ctx, query)
+		return stmt, false, err
+	}
+
+	// Prepare the statement without a context, as it outlives this request
+	stmt, err = s.db.Prepare(query)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another call may have cached the query, or filled the cache, meanwhile
+	if existing, ok := s.cache[query]; ok {
+		stmt.Close()
+		return existing, true, nil
+	}
+
+	if len(s.cache) >= maxCachedStatements {
+		return stmt, false, nil
+	}
+
+	s.cache[query] = stmt
+	return stmt, true, nil
+}
+
+func (s *statements) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, cached, err := s.prepare(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !cached {
+		defer stmt.Close()
+	}
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (s *statements) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, cached, err := s.prepare(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The rows stay usable after closing the statement, it is only
+	// released once they are closed too
+	if !cached {
+		defer stmt.Close()
+	}
+
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (s *statements) queryRow(ctx context.Context, query string, args ...any) rowScanner {
+	stmt, cached, err := s.prepare(ctx, query)
+
+	if err != nil {
+		return errRow{err}
+	}
+
+	if !cached {
+		defer stmt.Close()
+	}
+
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// transaction runs fn in a transaction, which is committed if fn succeeds
+// and rolled back otherwise
+func (s *statements) transaction(ctx context.Context, fn func(tx queryer) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	if err := fn(&txStatements{statements: s, tx: tx}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *statements) lockRow(ctx context.Context, table string, id int) error {
+	return nil
+}
+
+// txStatements runs queries within a transaction. Statements that are
+// already cached are reused, but new ones are only prepared for the
+// transaction, as preparing them on the database would need another
+// connection and SQLite only has one.
+type txStatements struct {
+	statements *statements
+	tx         *sql.Tx
+}
+
+// prepare returns a statement bound to the transaction, which is closed
+// along with it
+func (t *txStatements) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	t.statements.mu.Lock()
+	stmt, ok := t.statements.cache[query]
+	t.statements.mu.Unlock()
+
+	if ok {
+		return t.tx.StmtContext(ctx, stmt), nil
+	}
+
+	return t.tx.PrepareContext(ctx, query)
+}
+
+// transaction runs fn as part of the current transaction
+func (t *txStatements) transaction(ctx context.Context, fn func(tx queryer) error) error {
+	return fn(t)
+}
+
+// lockRow writes the row without changing it, which takes the row lock on
+// MySQL and the database write lock on SQLite. Reads after it see the
+// latest committed data, as MySQL only takes the transaction's snapshot on
+// its first plain read.
+func (t *txStatements) lockRow(ctx context.Context, table string, id int) error {
+	_, err := t.exec(ctx, "UPDATE "+table+" SET id = id WHERE id = ?", id)
+	return err
+}
+
+func (t *txStatements) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := t.prepare(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+func (t *txStatements) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	stmt, err := t.prepare(ctx, query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.QueryContext(ctx, args...)
+}
+
+func (t *txStatements) queryRow(ctx context.Context, query string, args ...any) rowScanner {
+	stmt, err := t.prepare(ctx, query)
+
+	if err != nil {
+		return errRow{err}
+	}
+
+	return stmt.QueryRowContext(ctx, args...)
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// openSQLite opens a SQLite database at path with a genders table. Each
+// call opens a separate handle, so two of them on the same path contend for
+// the database's locks rather than for a pooled connection.
+func openSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS genders (id INTEGER PRIMARY KEY, name TEXT NOT NULL)"); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestLockRowOutsideTransaction(t *testing.T) {
+	db := openSQLite(t, filepath.Join(t.TempDir(), "test.db"))
+
+	// No query is run, so even a table that doesn't exist is fine
+	if err := newStatements(db).lockRow(context.Background(), "missing", 1); err != nil {
+		t.Errorf("got %v outside a transaction", err)
+	}
+}
+
+// TestLockRow checks that a row locked in a transaction can't be written by
+// another connection until the transaction commits, and that locking it
+// leaves it unchanged
+func TestLockRow(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, other := openSQLite(t, path), openSQLite(t, path)
+
+	if _, err := db.Exec("INSERT INTO genders (id, name) VALUES (1, 'Female')"); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func() error {
+		_, err := other.ExecContext(ctx, "UPDATE genders SET name = 'Male' WHERE id = 1")
+		return err
+	}
+
+	s := newStatements(db)
+
+	err := s.transaction(ctx, func(tx queryer) error {
+		if err := tx.lockRow(ctx, "missing", 1); err == nil {
+			t.Error("locking a row of a missing table succeeded")
+		}
+
+		if err := tx.lockRow(ctx, "genders", 1); err != nil {
+			return err
+		}
+
+		if err := write(); err == nil {
+			t.Error("another connection wrote the locked row")
+		}
+
+		var name string
+
+		if err := tx.queryRow(ctx, "SELECT name FROM genders WHERE id = 1").Scan(&name); err != nil {
+			return err
+		}
+
+		if name != "Female" {
+			t.Errorf("locking the row changed it to %q", name)
+		}
+
+		return nil
+	})
+
+	mustDo(t, err)
+	mustDo(t, write())
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,231 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/njwong/me-api/models"
+)
+
+// ErrNotFound is returned when the requested record does not exist
+var ErrNotFound = errors.New("record not found")
+
+// ErrInvalidReplacement is returned when deleting a record that should be
+// replaced by another which doesn't exist, has been deleted or is the same
+// record
+var ErrInvalidReplacement = errors.New("invalid replacement")
+
+// ReferencedError is returned when a record can't be deleted because
+// characters still refer to it
+type ReferencedError struct {
+	Resource     string
+	ID           int
+	CharacterIDs []int
+}
+
+func (e *ReferencedError) Error() string {
+	return fmt.Sprintf("%s %d is referenced by %d characters", e.Resource, e.ID, len(e.CharacterIDs))
+}
+
+// MissingReferenceError is returned when a character is written with a
+// species or gender that doesn't exist or has been deleted
+type MissingReferenceError struct {
+	// Field is the character's field, species or gender
+	Field string
+	ID    int
+}
+
+func (e *MissingReferenceError) Error() string {
+	return fmt.Sprintf("%s %d does not exist", e.Field, e.ID)
+}
+
+// IsUnavailable reports whether err means the database couldn't be reached,
+// as opposed to a query failing
+func IsUnavailable(err error) bool {
+	var netError net.Error
+
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netError)
+}
+
+// SortField orders records by one of their fields
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// ListOptions selects a page of records, ordered by the Sort fields and then
+// by ID. The zero value returns every record ordered by ID. List calls also
+// return the total number of records regardless of the page.
+type ListOptions struct {
+	// Sort lists the fields to order by, most significant first. Character
+	// lists can be sorted by id, name, class, species and gender (by their
+	// names), genders and species by id and name.
+	Sort []SortField
+
+	// Limit is the maximum number of records to return, or 0 for no limit
+	Limit int
+
+	// Offset skips this many records
+	Offset int
+
+	// After only returns records with an ID greater than this. Cursors
+	// assume records are ordered by ID, so they can't be combined with Sort.
+	After int
+
+	// Before only returns records with an ID less than this. The records
+	// closest to Before are returned, still in ascending order.
+	Before int
+
+	// IncludeDeleted also returns records that have been soft deleted
+	IncludeDeleted bool
+}
+
+// CharacterFilter narrows a character list to those matching every field
+// that is set. Names and classes are compared case-insensitively.
+type CharacterFilter struct {
+	SpeciesID   int
+	SpeciesName string
+	GenderID    int
+	GenderName  string
+	Class       string
+}
+
+// ReferencePolicy decides what happens to the characters that refer to a
+// species or gender when it is deleted
+type ReferencePolicy string
+
+const (
+	// Restrict refuses to delete records that characters refer to, with a
+	// ReferencedError. It is the default.
+	Restrict ReferencePolicy = "restrict"
+
+	// Nullify clears the reference from the characters
+	Nullify ReferencePolicy = "nullify"
+
+	// Reassign points the characters at the ReplacementID record instead
+	Reassign ReferencePolicy = "reassign"
+)
+
+// DeleteOptions controls how a species or gender is deleted. Only characters
+// that haven't been deleted count as referring to it, and the references are
+// changed in the same transaction as the delete.
+type DeleteOptions struct {
+	Policy        ReferencePolicy
+	ReplacementID int
+}
+
+// The stores soft delete records, which are then left out of List unless
+// IncludeDeleted is set, and can't be read with Get or updated until they are
+// restored. Delete and Restore return ErrNotFound if the record is already
+// in the requested state.
+
+type CharacterStore interface {
+	List(ctx context.Context, filter CharacterFilter, opts ListOptions) ([]models.CharacterObject, int, error)
+	Get(ctx context.Context, id int) (*models.CharacterObject, error)
+	Create(ctx context.Context, character *models.Character) error
+	Update(ctx context.Context, id int, character *models.Character) error
+	Delete(ctx context.Context, id int) error
+	Restore(ctx context.Context, id int) error
+}
+
+type GenderStore interface {
+	List(ctx context.Context, opts ListOptions) ([]models.Gender, int, error)
+	Get(ctx context.Context, id int) (*models.Gender, error)
+	Create(ctx context.Context, gender *models.Gender) error
+	Update(ctx context.Context, id int, gender *models.Gender) error
+	Delete(ctx context.Context, id int, opts DeleteOptions) error
+	Restore(ctx context.Context, id int) error
+}
+
+type SpeciesStore interface {
+	List(ctx context.Context, opts ListOptions) ([]models.Species, int, error)
+	Get(ctx context.Context, id int) (*models.Species, error)
+	Create(ctx context.Context, species *models.Species) error
+	Update(ctx context.Context, id int, species *models.Species) error
+	Delete(ctx context.Context, id int, opts DeleteOptions) error
+	Restore(ctx context.Context, id int) error
+}
+
+// AuditFilter narrows the audit log to entries matching every field that is
+// set. Since is inclusive and Until exclusive.
+type AuditFilter struct {
+	Resource   string
+	ResourceID int
+	Actor      string
+	Since      time.Time
+	Until      time.Time
+}
+
+// AuditStore keeps the audit log of changes made through the other stores.
+// Entries are listed oldest first and can only be sorted by id.
+type AuditStore interface {
+	Record(ctx context.Context, entry *models.AuditEntry) error
+	List(ctx context.Context, filter AuditFilter, opts ListOptions) ([]models.AuditEntry, int, error)
+}
+
+// RevisionStore keeps every revision of the characters, species and genders.
+// Get returns ErrNotFound if the revision doesn't exist, and List orders
+// revisions by number, which is the only field they can be sorted by.
+type RevisionStore interface {
+	// Record adds the next revision of a record, setting its number
+	Record(ctx context.Context, revision *models.Revision) error
+	List(ctx context.Context, resource string, id int, opts ListOptions) ([]models.Revision, int, error)
+	Get(ctx context.Context, resource string, id int, revision int) (*models.Revision, error)
+
+	// AsOf returns the latest revision of every record at time t
+	AsOf(ctx context.Context, t time.Time) ([]models.Revision, error)
+}
+
+// Store groups the stores for each resource served by the API
+type Store struct {
+	Characters CharacterStore
+	Genders    GenderStore
+	Species    SpeciesStore
+	Audit      AuditStore
+	Revisions  RevisionStore
+
+	// transaction runs fn with stores bound to a new transaction
+	transaction func(ctx context.Context, fn func(tx *Store) error) error
+}
+
+// Transaction runs fn with a copy of s whose writes are committed together
+// if fn returns nil, and rolled back if it returns an error. Write hooks are
+// only called once the transaction has been committed, and reads made in it
+// aren't cached. Records read with Get are locked until the transaction
+// ends, so they can be checked and then written without another writer
+// changing them in between. Transactions started within fn join the outer
+// one.
+func (s *Store) Transaction(ctx context.Context, fn func(tx *Store) error) error {
+	if s.transaction == nil {
+		return errors.New("store doesn't support transactions")
+	}
+
+	return s.transaction(ctx, fn)
+}
+
+// wrapTransaction returns the transaction function for a store that wraps s,
+// where wrap applies the same wrapping to the stores bound to a transaction
+func wrapTransaction(s *Store, wrap func(tx *Store) *Store) func(ctx context.Context, fn func(tx *Store) error) error {
+	return func(ctx context.Context, fn func(tx *Store) error) error {
+		return s.Transaction(ctx, func(tx *Store) error {
+			return fn(wrap(tx))
+		})
+	}
+}
+
+// reverse reverses the order of a slice in place
+func reverse[T any](items []T) {
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+}
@@ -0,0 +1,189 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/njwong/me-api/models"
+	"github.com/njwong/me-api/store"
+	"github.com/njwong/me-api/validation"
+)
+
+// eachStore runs test against the memory store and a SQLite store
+func eachStore(t *testing.T, test func(t *testing.T, s *store.Store)) {
+	t.Run("memory", func(t *testing.T) { test(t, store.NewMemory()) })
+	t.Run("sqlite", func(t *testing.T) { test(t, newSQLite(t)) })
+}
+
+// fixture is a species and two genders with a character referring to each
+type fixture struct {
+	species       models.Species
+	gender, other models.Gender
+	live, deleted models.Character
+}
+
+func newFixture(t *testing.T, s *store.Store) *fixture {
+	t.Helper()
+
+	ctx := context.Background()
+	f := &fixture{species: models.Species{Name: "Asari"}, gender: models.Gender{Name: "Female"}, other: models.Gender{Name: "Male"}}
+
+	mustDo(t, s.Species.Create(ctx, &f.species))
+	mustDo(t, s.Genders.Create(ctx, &f.gender))
+	mustDo(t, s.Genders.Create(ctx, &f.other))
+
+	f.live = models.Character{Name: "Liara", Species: f.species.ID, Gender: f.gender.ID}
+	f.deleted = models.Character{Name: "Benezia", Species: f.species.ID, Gender: f.gender.ID}
+
+	mustDo(t, s.Characters.Create(ctx, &f.live))
+	mustDo(t, s.Characters.Create(ctx, &f.deleted))
+	mustDo(t, s.Characters.Delete(ctx, f.deleted.ID))
+
+	return f
+}
+
+func TestDeleteRestrict(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		f := newFixture(t, s)
+
+		err := s.Genders.Delete(ctx, f.gender.ID, store.DeleteOptions{Policy: store.Restrict})
+
+		var referenced *store.ReferencedError
+
+		if !errors.As(err, &referenced) {
+			t.Fatalf("got %v, want a ReferencedError", err)
+		}
+
+		// Deleted characters don't stop the delete
+		if len(referenced.CharacterIDs) != 1 || referenced.CharacterIDs[0] != f.live.ID {
+			t.Errorf("got references %v, want [%d]", referenced.CharacterIDs, f.live.ID)
+		}
+	})
+}
+
+// TestDeleteNullify checks that a nullified character can be written back
+// as it is read, and that deleted characters lose the reference too
+func TestDeleteNullify(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		f := newFixture(t, s)
+
+		mustDo(t, s.Genders.Delete(ctx, f.gender.ID, store.DeleteOptions{Policy: store.Nullify}))
+
+		stored, err := s.Characters.Get(ctx, f.live.ID)
+		mustDo(t, err)
+
+		if stored.Gender != nil || stored.SpeciesID() != f.species.ID {
+			t.Fatalf("got gender %v and species %d", stored.Gender, stored.SpeciesID())
+		}
+
+		character := models.Character{Name: stored.Name, Species: stored.SpeciesID(), Gender: stored.GenderID(), Class: stored.Class}
+
+		if fieldErrors := validation.Struct(character); len(fieldErrors) > 0 {
+			t.Errorf("nullified character is invalid - %v", fieldErrors)
+		}
+
+		mustDo(t, s.Characters.Update(ctx, f.live.ID, &character))
+		mustDo(t, s.Characters.Restore(ctx, f.deleted.ID))
+
+		restored, err := s.Characters.Get(ctx, f.deleted.ID)
+		mustDo(t, err)
+
+		if restored.Gender != nil {
+			t.Errorf("restored character has gender %d", restored.Gender.ID)
+		}
+	})
+}
+
+func TestDeleteReassign(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		f := newFixture(t, s)
+
+		err := s.Genders.Delete(ctx, f.gender.ID, store.DeleteOptions{Policy: store.Reassign, ReplacementID: f.gender.ID})
+
+		if !errors.Is(err, store.ErrInvalidReplacement) {
+			t.Fatalf("reassigning to the deleted gender gave %v", err)
+		}
+
+		mustDo(t, s.Genders.Delete(ctx, f.gender.ID, store.DeleteOptions{Policy: store.Reassign, ReplacementID: f.other.ID}))
+		mustDo(t, s.Characters.Restore(ctx, f.deleted.ID))
+
+		for _, id := range []int{f.live.ID, f.deleted.ID} {
+			stored, err := s.Characters.Get(ctx, id)
+			mustDo(t, err)
+
+			if stored.GenderID() != f.other.ID {
+				t.Errorf("character %d has gender %d, want %d", id, stored.GenderID(), f.other.ID)
+			}
+		}
+	})
+}
+
+// TestRestoreDanglingReference checks that restoring a character whose
+// species was deleted while it was deleted doesn't bring back the reference
+func TestRestoreDanglingReference(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		f := newFixture(t, s)
+
+		mustDo(t, s.Characters.Delete(ctx, f.live.ID))
+		mustDo(t, s.Species.Delete(ctx, f.species.ID, store.DeleteOptions{Policy: store.Restrict}))
+		mustDo(t, s.Characters.Restore(ctx, f.live.ID))
+
+		stored, err := s.Characters.Get(ctx, f.live.ID)
+		mustDo(t, err)
+
+		if stored.Species != nil || stored.GenderID() != f.gender.ID {
+			t.Errorf("got species %v and gender %d", stored.Species, stored.GenderID())
+		}
+	})
+}
+
+// TestMissingReference checks that characters can't be written with a
+// species or gender that doesn't exist or has been deleted
+func TestMissingReference(t *testing.T) {
+	eachStore(t, func(t *testing.T, s *store.Store) {
+		ctx := context.Background()
+		f := newFixture(t, s)
+
+		mustDo(t, s.Genders.Delete(ctx, f.other.ID, store.DeleteOptions{Policy: store.Restrict}))
+
+		tests := []struct {
+			name      string
+			character models.Character
+			field     string
+		}{
+			{"unknown species", models.Character{Name: "Shepard", Species: 99}, "species"},
+			{"deleted gender", models.Character{Name: "Shepard", Gender: f.other.ID}, "gender"},
+		}
+
+		for _, test := range tests {
+			var missing *store.MissingReferenceError
+
+			character := test.character
+
+			if err := s.Characters.Create(ctx, &character); !errors.As(err, &missing) || missing.Field != test.field {
+				t.Errorf("creating with %s gave %v", test.name, err)
+			}
+
+			character = test.character
+
+			if err := s.Characters.Update(ctx, f.live.ID, &character); !errors.As(err, &missing) || missing.Field != test.field {
+				t.Errorf("updating with %s gave %v", test.name, err)
+			}
+		}
+
+		stored, err := s.Characters.Get(ctx, f.live.ID)
+		mustDo(t, err)
+
+		if stored.Name != f.live.Name || stored.GenderID() != f.gender.ID {
+			t.Errorf("character was changed to %+v", stored)
+		}
+
+		// Characters without a species or gender don't refer to anything
+		mustDo(t, s.Characters.Create(ctx, &models.Character{Name: "Shepard"}))
+	})
+}
@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why a single field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Struct validates the fields of a struct against their `validate` tags and
+// returns an error for each invalid field. Fields are named after their JSON
+// names. The supported rules are:
+//
+//   - required: strings must not be blank and numbers must not be zero
+//   - min=N: strings need at least N characters and numbers must be >= N
+//   - max=N: strings can have at most N characters and numbers must be <= N
+//
+// For example `validate:"required,max=255"`.
+func Struct(v any) []FieldError {
+	errors := []FieldError{}
+
+	value := reflect.Indirect(reflect.ValueOf(v))
+	valueType := value.Type()
+
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		tag := field.Tag.Get("validate")
+
+		if tag == "" {
+			continue
+		}
+
+		name := jsonName(field)
+
+		for _, rule := range strings.Split(tag, ",") {
+			if message := check(value.Field(i), rule); message != "" {
+				errors = append(errors, FieldError{Field: name, Message: message})
+				break
+			}
+		}
+	}
+
+	return errors
+}
+
+// check applies a single rule to a field and returns a message if it fails
+func check(field reflect.Value, rule string) string {
+	name, param, _ := strings.Cut(rule, "=")
+
+	switch name {
+	case "required":
+		if isBlank(field) {
+			return "is required"
+		}
+	case "min", "max":
+		limit, err := strconv.Atoi(param)
+
+		if err != nil {
+			panic(fmt.Sprintf("validation: invalid %s rule %q", name, rule))
+		}
+
+		return checkLimit(field, name, limit)
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule))
+	}
+
+	return ""
+}
+
+func checkLimit(field reflect.Value, name string, limit int) string {
+	switch field.Kind() {
+	case reflect.String:
+		length := utf8.RuneCountInString(field.String())
+
+		if name == "min" && length < limit {
+			return fmt.Sprintf("must be at least %d characters", limit)
+		}
+
+		if name == "max" && length > limit {
+			return fmt.Sprintf("must be at most %d characters", limit)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if name == "min" && field.Int() < int64(limit) {
+			return fmt.Sprintf("must be at least %d", limit)
+		}
+
+		if name == "max" && field.Int() > int64(limit) {
+			return fmt.Sprintf("must be at most %d", limit)
+		}
+	}
+
+	return ""
+}
+
+func isBlank(field reflect.Value) bool {
+	if field.Kind() == reflect.String {
+		return strings.TrimSpace(field.String()) == ""
+	}
+
+	return field.IsZero()
+}
+
+// jsonName returns the name a struct field has in JSON
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
@@ -0,0 +1,76 @@
+package validation_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/njwong/me-api/validation"
+)
+
+type record struct {
+	Name    string `json:"name" validate:"required,min=2,max=5"`
+	Count   int    `json:"count" validate:"min=0,max=10"`
+	Species int    `json:"species,omitempty" validate:"required"`
+	Class   string `validate:"max=3"`
+	Notes   string `json:"notes"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := record{Name: "Tali", Count: 3, Species: 1}
+
+	tests := []struct {
+		name   string
+		change func(r *record)
+		want   []validation.FieldError
+	}{
+		{"valid", func(r *record) {}, []validation.FieldError{}},
+		{"blank", func(r *record) { r.Name = "  " }, []validation.FieldError{{Field: "name", Message: "is required"}}},
+		{"too short", func(r *record) { r.Name = "T" }, []validation.FieldError{{Field: "name", Message: "must be at least 2 characters"}}},
+		{"too long", func(r *record) { r.Name = "Garrus" }, []validation.FieldError{{Field: "name", Message: "must be at most 5 characters"}}},
+		{"counts characters rather than bytes", func(r *record) { r.Name = "éééé" }, []validation.FieldError{}},
+		{"below minimum", func(r *record) { r.Count = -1 }, []validation.FieldError{{Field: "count", Message: "must be at least 0"}}},
+		{"above maximum", func(r *record) { r.Count = 11 }, []validation.FieldError{{Field: "count", Message: "must be at most 10"}}},
+		{"zero number", func(r *record) { r.Species = 0 }, []validation.FieldError{{Field: "species", Message: "is required"}}},
+		{"field without a JSON name", func(r *record) { r.Class = "Engineer" }, []validation.FieldError{{Field: "Class", Message: "must be at most 3 characters"}}},
+		{
+			"several fields, first rule only",
+			func(r *record) { r.Name = ""; r.Count = 20 },
+			[]validation.FieldError{{Field: "name", Message: "is required"}, {Field: "count", Message: "must be at most 10"}},
+		},
+	}
+
+	for _, test := range tests {
+		r := valid
+		test.change(&r)
+
+		if got := validation.Struct(&r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+
+		// Values validate the same as pointers
+		if got := validation.Struct(r); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s by value: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStructInvalidRules(t *testing.T) {
+	for name, v := range map[string]any{
+		"unknown rule": struct {
+			Name string `validate:"email"`
+		}{},
+		"invalid limit": struct {
+			Name string `validate:"max=ten"`
+		}{},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s didn't panic", name)
+				}
+			}()
+
+			validation.Struct(v)
+		}()
+	}
+}